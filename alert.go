@@ -0,0 +1,401 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TheSp1der/goerror"
+)
+
+// validate verifies the alert rule can be evaluated, parsing the
+// expression of expression rules.
+func (r *alertRule) validate() error {
+	var err error
+
+	switch r.Type {
+	case "above", "below":
+		if r.Value <= 0 {
+			return errors.New("alert " + r.Name + ": price must be greater than zero")
+		}
+	case "change", "since":
+		if r.Value == 0 {
+			return errors.New("alert " + r.Name + ": percent change must not be zero")
+		}
+	case "gain":
+		if r.Value == 0 {
+			return errors.New("alert " + r.Name + ": gain/loss must not be zero")
+		}
+	case "goldencross", "deathcross", "high52", "low52":
+	case "overbought", "oversold":
+		if r.Value < 0 || r.Value > 100 {
+			return errors.New("alert " + r.Name + ": RSI must be between 0 and 100")
+		}
+	case "bollinger", "volume":
+		if r.Value < 0 {
+			return errors.New("alert " + r.Name + ": value must not be negative")
+		}
+	case "expression":
+		if r.Expression == "" {
+			return errors.New("alert " + r.Name + ": expression is required")
+		}
+		if r.expr, err = parseExpr(r.Expression); err != nil {
+			return errors.New("alert " + r.Name + ": expression: " + err.Error())
+		}
+	default:
+		return errors.New("alert " + r.Name + ": unknown type \"" + r.Type + "\"")
+	}
+
+	if r.Ticker == "" && r.Type != "gain" {
+		return errors.New("alert " + r.Name + ": ticker is required")
+	}
+	if r.Ticker != "" && !regexp.MustCompile(`^[a-z0-9]+$`).MatchString(strings.TrimSpace(strings.ToLower(r.Ticker))) {
+		return errors.New("alert " + r.Name + ": ticker format error \"" + r.Ticker + "\"")
+	}
+	if r.Account != "" && r.Type != "gain" {
+		return errors.New("alert " + r.Name + ": account is only used by gain alerts")
+	}
+
+	if r.Cooldown < 0 {
+		return errors.New("alert " + r.Name + ": cooldown must not be negative")
+	}
+	if r.Hysteresis < 0 {
+		return errors.New("alert " + r.Name + ": hysteresis must not be negative")
+	}
+	if r.Period < 0 {
+		return errors.New("alert " + r.Name + ": period must not be negative")
+	}
+	if r.Hysteresis > 0 {
+		switch r.Type {
+		case "above", "below", "change", "since", "gain", "overbought", "oversold", "volume":
+		default:
+			return errors.New("alert " + r.Name + ": hysteresis is not used by " + r.Type + " alerts")
+		}
+	}
+	if _, _, err = quietHours(r.QuietHours); err != nil {
+		return errors.New("alert " + r.Name + ": " + err.Error())
+	}
+	switch r.Session {
+	case "", "any", "open", "closed":
+	default:
+		return errors.New("alert " + r.Name + ": unknown session \"" + r.Session + "\"")
+	}
+	switch r.Severity {
+	case "", "low", "normal", "high", "urgent":
+	default:
+		return errors.New("alert " + r.Name + ": unknown severity \"" + r.Severity + "\"")
+	}
+
+	return nil
+}
+
+// quietHours parses quiet hours in the form HH:MM-HH:MM, returning the
+// start and end as minutes since midnight.
+func quietHours(hours string) (int, int, error) {
+	var minutes []int
+
+	if hours == "" {
+		return 0, 0, nil
+	}
+
+	for _, h := range strings.Split(hours, "-") {
+		t, err := time.Parse("15:04", strings.TrimSpace(h))
+		if err != nil {
+			return 0, 0, errors.New("quiet hours \"" + hours + "\" are not in the form HH:MM-HH:MM")
+		}
+		minutes = append(minutes, t.Hour()*60+t.Minute())
+	}
+	if len(minutes) != 2 {
+		return 0, 0, errors.New("quiet hours \"" + hours + "\" are not in the form HH:MM-HH:MM")
+	}
+
+	return minutes[0], minutes[1], nil
+}
+
+// scheduled returns true when the rule should be checked at the time,
+// outside of its quiet hours and within its market session.
+func (r alertRule) scheduled(t time.Time, open bool) bool {
+	if start, end, _ := quietHours(r.QuietHours); start != end {
+		m := t.Hour()*60 + t.Minute()
+		if (start < end && m >= start && m < end) || (start > end && (m >= start || m < end)) {
+			return false
+		}
+	}
+
+	switch r.Session {
+	case "open":
+		return open
+	case "closed":
+		return !open
+	}
+	return true
+}
+
+// released returns the rule with its threshold moved back by the
+// hysteresis, an active rule is re-armed once this is no longer true.
+// Prices and signed thresholds are not moved across zero.
+func (r alertRule) released() alertRule {
+	switch {
+	case r.Type == "above":
+		r.Value = math.Max(r.Value-r.Hysteresis, 0.000001)
+	case r.Type == "below":
+		r.Value = r.Value + r.Hysteresis
+	case r.Type == "overbought":
+		r.Value = math.Max(r.threshold(70)-r.Hysteresis, 0.000001)
+	case r.Type == "oversold":
+		r.Value = math.Min(r.threshold(30)+r.Hysteresis, 100)
+	case r.Type == "volume":
+		r.Value = math.Max(r.threshold(2)-r.Hysteresis, 0.000001)
+	case r.Value < 0:
+		r.Value = math.Min(r.Value+r.Hysteresis, -0.000001)
+	default:
+		r.Value = math.Max(r.Value-r.Hysteresis, 0.000001)
+	}
+	return r
+}
+
+// validateAlerts verifies every alert rule has a unique name and can be
+// evaluated.
+func (c configuration) validateAlerts() error {
+	var names = make(map[string]bool)
+
+	for i := range c.Alerts {
+		r := &c.Alerts[i]
+
+		if r.Name == "" {
+			return errors.New("alert name is required")
+		}
+		if names[r.Name] {
+			return errors.New("alert " + r.Name + " is defined more than once")
+		}
+		names[r.Name] = true
+
+		if err := r.validate(); err != nil {
+			return err
+		}
+
+		if r.Account != "" && r.Account != "default" {
+			found := false
+			for _, a := range c.Accounts {
+				found = found || a.Name == r.Account
+			}
+			if !found {
+				return errors.New("alert " + r.Name + ": unknown account " + r.Account)
+			}
+		}
+	}
+
+	return nil
+}
+
+// crossed returns true when the value has reached the threshold, a
+// negative threshold is reached from above and a positive one from below.
+func crossed(value float64, threshold float64) bool {
+	if threshold < 0 {
+		return value <= threshold
+	}
+	return value >= threshold
+}
+
+// quote returns the stock data of the ticker.
+func quote(stock iex, ticker string) (iexData, bool) {
+	for _, k := range stock {
+		if strings.TrimSpace(strings.ToLower(k.Company.Symbol)) == strings.TrimSpace(strings.ToLower(ticker)) {
+			return k, true
+		}
+	}
+	return iexData{}, false
+}
+
+// check returns whether the rule is true for the stock data along with a
+// description of the current value, the reference price is used by rules
+// measuring change since creation. Rules that cannot be evaluated against
+// the stock data are never true.
+func (r alertRule) check(stock iex, reference float64) (bool, string) {
+	var (
+		symbol = strings.ToUpper(r.Ticker)
+		value  = strconv.FormatFloat(r.Value, 'f', 2, 64)
+	)
+
+	if r.Type == "gain" {
+		var (
+			gain  float64
+			found bool
+		)
+
+		for _, i := range positions {
+			if (r.Ticker != "" && strings.ToLower(i.Ticker) != strings.ToLower(r.Ticker)) || (r.Account != "" && i.Account != r.Account) {
+				continue
+			}
+			if k, ok := quote(stock, i.Ticker); ok {
+				_, _, base, _, rated := lotGainLoss(i, k)
+				if !rated {
+					return false, ""
+				}
+				gain = gain + base
+				found = true
+			}
+		}
+
+		if symbol == "" {
+			symbol = "portfolio"
+		}
+		if r.Account != "" {
+			symbol = symbol + " (" + r.Account + ")"
+		}
+
+		return found && crossed(gain, r.Value), symbol + " gain/loss " + strconv.FormatFloat(gain, 'f', 2, 64) + " " + baseCurrency() + " crossed " + value
+	}
+
+	k, ok := quote(stock, r.Ticker)
+	if !ok || k.Price <= 0 {
+		return false, ""
+	}
+	price := strconv.FormatFloat(k.Price, 'f', 2, 64)
+
+	switch r.Type {
+	case "above":
+		return k.Price > r.Value, symbol + " price " + price + " is above " + value
+	case "below":
+		return k.Price < r.Value, symbol + " price " + price + " is below " + value
+	case "change":
+		if k.Quote.PreviousClose <= 0 {
+			return false, ""
+		}
+		change := (k.Price/k.Quote.PreviousClose - 1) * 100
+		return crossed(change, r.Value), symbol + " price " + price + " changed " + strconv.FormatFloat(change, 'f', 2, 64) + "% from the previous close"
+	case "since":
+		if reference <= 0 {
+			return false, ""
+		}
+		change := (k.Price/reference - 1) * 100
+		return crossed(change, r.Value), symbol + " price " + price + " changed " + strconv.FormatFloat(change, 'f', 2, 64) + "% since " + strconv.FormatFloat(reference, 'f', 2, 64)
+	case "goldencross", "deathcross", "high52", "low52", "overbought", "oversold", "bollinger":
+		return r.indicator(k)
+	case "volume":
+		for _, v := range relativeVolumes(iex{symbol: k}) {
+			return v.Relative >= r.threshold(2), symbol + " volume " + volumeText(float64(v.Volume)) + " is " + strconv.FormatFloat(v.Relative, 'f', 2, 64) + " times the " + volumeText(v.Expected) + " expected by now"
+		}
+		return false, ""
+	case "expression":
+		if r.expr == nil {
+			return false, ""
+		}
+		return r.expr.eval(k).(bool), symbol + " " + r.Expression + " (" + r.expr.describe(k) + ")"
+	}
+
+	return false, ""
+}
+
+// evaluate checks every alert rule against the stock data and returns
+// the rules that have become true since they were last checked. The
+// state of each rule is stored in the history database when one is
+// provided so alerts are not reported again after a restart.
+func (e *alertEngine) evaluate(stock iex) []alertEvent {
+	var (
+		events  []alertEvent
+		now     = time.Now()
+		open, _ = marketStatus()
+	)
+
+	e.Lock()
+	defer e.Unlock()
+
+	if e.State == nil {
+		e.State = history.alertStates()
+	}
+
+	for _, r := range config.Alerts {
+		st := e.State[r.Name]
+		prev := st
+
+		if !r.scheduled(now, open) {
+			continue
+		}
+
+		// the reference price of a change since creation is the price
+		// provided or the first price seen
+		if r.Type == "since" && st.Reference == 0 {
+			if r.Price > 0 {
+				st.Reference = r.Price
+			} else if k, ok := quote(stock, r.Ticker); ok && k.Price > 0 {
+				st.Reference = k.Price
+			}
+		}
+
+		active, message := r.check(stock, st.Reference)
+		switch {
+		case st.Active && !active:
+			// re-arm once the value is outside the hysteresis band
+			if r.Hysteresis == 0 {
+				st.Active = false
+			} else if held, _ := r.released().check(stock, st.Reference); !held {
+				st.Active = false
+			}
+		case !st.Active && active:
+			// a crossing during the cooldown stays pending until it ends
+			if now.Sub(st.Fired) >= time.Duration(r.Cooldown)*time.Minute {
+				st.Active = true
+				st.Fired = now
+				event := alertEvent{
+					Rule:     r.Name,
+					Ticker:   strings.ToLower(r.Ticker),
+					Time:     now,
+					Message:  message,
+					Severity: r.Severity,
+				}
+				if k, ok := quote(stock, r.Ticker); ok {
+					event.Change = k.Quote.Change
+				}
+				if event.Severity == "" {
+					event.Severity = "normal"
+				}
+				events = append(events, event)
+			}
+		}
+
+		e.State[r.Name] = st
+		if st != prev {
+			if err := history.putAlertState(r.Name, st); err != nil {
+				goerror.Warning(err)
+			}
+		}
+	}
+
+	// keep the most recent events for display
+	e.Recent = append(e.Recent, events...)
+	if len(e.Recent) > 10 {
+		e.Recent = e.Recent[len(e.Recent)-10:]
+	}
+
+	return events
+}
+
+// recent returns the most recent events, newest first.
+func (e *alertEngine) recent() []alertEvent {
+	var events []alertEvent
+
+	e.Lock()
+	defer e.Unlock()
+
+	for i := len(e.Recent) - 1; i >= 0; i-- {
+		events = append(events, e.Recent[i])
+	}
+
+	return events
+}
+
+// deliverAlerts sends the events to the notifiers, and by e-mail when
+// mail is configured.
+func deliverAlerts(events []alertEvent) {
+	n := alertNotification(events)
+
+	notify(n)
+
+	if mailEnabled() {
+		mailAlerts(n.Subject, events)
+	}
+}
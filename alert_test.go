@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAlertValidate(t *testing.T) {
+	tests := []struct {
+		rule alertRule
+		want string
+	}{
+		{alertRule{Name: "a", Type: "above", Ticker: "amd", Value: 30}, ""},
+		{alertRule{Name: "a", Type: "above", Ticker: "amd"}, "price must be greater than zero"},
+		{alertRule{Name: "a", Type: "gain", Value: -500}, ""},
+		{alertRule{Name: "a", Type: "gain", Account: "ira", Value: 1000}, ""},
+		{alertRule{Name: "a", Type: "gain"}, "gain/loss must not be zero"},
+		{alertRule{Name: "a", Type: "change", Ticker: "amd"}, "percent change must not be zero"},
+		{alertRule{Name: "a", Type: "goldencross"}, "ticker is required"},
+		{alertRule{Name: "a", Type: "bollinger", Ticker: "amd", Hysteresis: 1}, "hysteresis is not used"},
+	}
+
+	for _, tc := range tests {
+		err := tc.rule.validate()
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s rule: %v", tc.rule.Type, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Errorf("%s rule = %v, want it to mention %q", tc.rule.Type, err, tc.want)
+		}
+	}
+}
+
+func TestReleased(t *testing.T) {
+	tests := []struct {
+		rule alertRule
+		want float64
+	}{
+		{alertRule{Type: "above", Value: 30, Hysteresis: 0.5}, 29.5},
+		{alertRule{Type: "above", Value: 1, Hysteresis: 5}, 0.000001},
+		{alertRule{Type: "below", Value: 30, Hysteresis: 0.5}, 30.5},
+		{alertRule{Type: "change", Value: 5, Hysteresis: 10}, 0.000001},
+		{alertRule{Type: "change", Value: -5, Hysteresis: 10}, -0.000001},
+		{alertRule{Type: "gain", Value: 1000, Hysteresis: 100}, 900},
+		{alertRule{Type: "oversold", Hysteresis: 5}, 35},
+	}
+
+	for _, tc := range tests {
+		if got := tc.rule.released().Value; got != tc.want {
+			t.Errorf("%s %v released with %v = %v, want %v", tc.rule.Type, tc.rule.Value, tc.rule.Hysteresis, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"encoding/csv"
+)
+
+// attachmentFormats are the report attachments that can be added to the
+// end of day e-mail.
+var attachmentFormats = []string{"csv", "pdf"}
+
+// validAttachments verifies every attachment format is known.
+func validAttachments(formats []string) error {
+	for _, f := range formats {
+		known := false
+		for _, a := range attachmentFormats {
+			if strings.ToLower(f) == a {
+				known = true
+			}
+		}
+		if !known {
+			return errors.New("unknown attachment \"" + f + "\"")
+		}
+	}
+	return nil
+}
+
+// writePositionsCSV writes the lots held by the recipient with the latest
+// quote and their value in the base currency as CSV, followed by the
+// quotes of tickers the recipient follows without holding.
+func writePositionsCSV(w io.Writer, stock iex, r recipient) error {
+	var (
+		out  = csv.NewWriter(w)
+		held = make(map[string]bool)
+		rows [][]string
+	)
+
+	if err := out.Write([]string{"Account", "Ticker", "Company", "Date Acquired", "Quantity", "Cost Price", "Currency",
+		"Price", "Change", "Change %", "Market Value (" + baseCurrency() + ")", "Gain/Loss (" + baseCurrency() + ")"}); err != nil {
+		return err
+	}
+
+	stock = r.stocks(stock)
+	for _, i := range r.positions() {
+		symbol := strings.TrimSpace(strings.ToLower(i.Ticker))
+		for _, k := range stock {
+			if strings.TrimSpace(strings.ToLower(k.Company.Symbol)) != symbol {
+				continue
+			}
+
+			var (
+				cval, _, base, _, rated = lotGainLoss(i, k)
+				value, gain             string
+				acquired                string
+			)
+			if rated {
+				value = strconv.FormatFloat(cval, 'f', 2, 64)
+				gain = strconv.FormatFloat(base, 'f', 2, 64)
+			}
+			if !i.Date.IsZero() {
+				acquired = i.Date.Format(dateFormat)
+			}
+			held[symbol] = true
+
+			rows = append(rows, []string{
+				i.Account,
+				strings.ToUpper(symbol),
+				k.Company.CompanyName,
+				acquired,
+				strconv.FormatFloat(i.Quantity, 'f', -1, 64),
+				strconv.FormatFloat(i.Price, 'f', 2, 64),
+				lotCurrency(i, k),
+				strconv.FormatFloat(k.Price, 'f', 2, 64),
+				strconv.FormatFloat(k.Quote.Change, 'f', 2, 64),
+				strconv.FormatFloat(k.Quote.ChangePercent*100, 'f', 2, 64),
+				value,
+				gain,
+			})
+		}
+	}
+
+	for _, k := range stock {
+		symbol := strings.TrimSpace(strings.ToLower(k.Company.Symbol))
+		if held[symbol] || symbol == "" {
+			continue
+		}
+
+		rows = append(rows, []string{
+			"",
+			strings.ToUpper(symbol),
+			k.Company.CompanyName,
+			"", "", "",
+			quoteCurrency(k),
+			strconv.FormatFloat(k.Price, 'f', 2, 64),
+			strconv.FormatFloat(k.Quote.Change, 'f', 2, 64),
+			strconv.FormatFloat(k.Quote.ChangePercent*100, 'f', 2, 64),
+			"", "",
+		})
+	}
+
+	// sort by account then ticker, with the tickers not held last
+	sort.SliceStable(rows, func(i, j int) bool {
+		if (rows[i][0] == "") != (rows[j][0] == "") {
+			return rows[j][0] == ""
+		}
+		if rows[i][0] != rows[j][0] {
+			return rows[i][0] < rows[j][0]
+		}
+		return rows[i][1] < rows[j][1]
+	})
+
+	if err := out.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return out.Error()
+}
+
+// reportAttachments returns the attachments of the report requested by the
+// recipient, the PDF is rendered from the HTML report and its charts.
+func reportAttachments(stock iex, r recipient, body string, charts []mailPart) ([]mailPart, error) {
+	var (
+		parts []mailPart
+		name  = "stockwatch-" + time.Now().Format(dateFormat)
+	)
+
+	for _, f := range r.Attachments {
+		switch strings.ToLower(f) {
+		case "csv":
+			var buf bytes.Buffer
+			if err := writePositionsCSV(&buf, stock, r); err != nil {
+				return parts, err
+			}
+			parts = append(parts, mailPart{Name: name + ".csv", ContentType: "text/csv", Data: buf.Bytes()})
+		case "pdf":
+			pdf, err := reportPDF(body, charts)
+			if err != nil {
+				return parts, err
+			}
+			parts = append(parts, mailPart{Name: name + ".pdf", ContentType: "application/pdf", Data: pdf})
+		}
+	}
+
+	return parts, nil
+}
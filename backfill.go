@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"encoding/json"
+	"net/url"
+)
+
+// chartRanges are the ranges of daily bars available from the provider
+// and the number of days each covers.
+var chartRanges = []struct {
+	Name string
+	Days int
+}{
+	{Name: "1m", Days: 30},
+	{Name: "3m", Days: 91},
+	{Name: "6m", Days: 182},
+	{Name: "1y", Days: 365},
+	{Name: "2y", Days: 730},
+	{Name: "5y", Days: 1826},
+}
+
+// getChart will get the daily bars of the stocks over the range.
+func getChart(symbols []string, rng string) (iex, error) {
+	var (
+		err       error
+		newURL    url.URL
+		params    url.Values
+		headers   httpHeader
+		resp      []byte
+		stockData iex
+	)
+
+	// prepare the url
+	newURL.Scheme = "https"
+	newURL.Host = "api.iextrading.com"
+	newURL.Path = "1.0/stock/market/batch"
+
+	// url parameters
+	params = newURL.Query()
+	params.Add("symbols", strings.Join(symbols, ","))
+	params.Add("types", "chart")
+	params.Add("range", rng)
+	newURL.RawQuery = params.Encode()
+
+	// connect and retrieve data from remote source
+	if resp, err = httpGet(newURL.String(), headers); err != nil {
+		return stockData, err
+	}
+
+	// unmarshal response
+	if err = json.Unmarshal(resp, &stockData); err != nil {
+		return stockData, err
+	}
+
+	return stockData, nil
+}
+
+// lastTradingDay returns the most recent trading day the market has
+// closed on.
+func lastTradingDay() time.Time {
+	est, _ := time.LoadLocation("America/New_York")
+	ct := time.Now().In(est)
+
+	// midday avoids the date changing across daylight saving transitions
+	d := time.Date(ct.Year(), ct.Month(), ct.Day(), 12, 0, 0, 0, est)
+	if _, close := marketHours(d); ct.Before(close) {
+		d = d.AddDate(0, 0, -1)
+	}
+	for !tradingDay(d) {
+		d = d.AddDate(0, 0, -1)
+	}
+
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// chartRange returns the smallest range of daily bars needed to cover
+// the days since the symbol was last backfilled. Symbols that have never
+// been backfilled are covered back to their first purchase, or five
+// years when they have never been purchased.
+func chartRange(symbol string, through time.Time) (string, bool) {
+	var (
+		days int
+		from time.Time
+	)
+
+	if last, err := time.ParseInLocation(dateFormat, history.backfilled(symbol), time.Local); err == nil {
+		from = last
+	} else {
+		from = through.AddDate(-5, 0, 0)
+		for _, i := range positions {
+			if strings.ToLower(i.Ticker) == symbol && !i.Date.IsZero() && i.Date.Before(from) {
+				from = i.Date
+			}
+		}
+	}
+
+	if !from.Before(through) {
+		return "", false
+	}
+
+	days = int(through.Sub(from).Hours()/24) + 1
+	for _, r := range chartRanges {
+		if r.Days >= days {
+			return r.Name, true
+		}
+	}
+
+	return chartRanges[len(chartRanges)-1].Name, true
+}
+
+// backfillHistory stores the daily bars of every tracked ticker missing
+// since it was last backfilled. Prices already recorded are replaced by
+// the bars from the provider so it is safe to run repeatedly.
+func backfillHistory() error {
+	var (
+		through = lastTradingDay()
+		ranges  = make(map[string][]string)
+		seen    = make(map[string]bool)
+	)
+
+	if history.db == nil {
+		return errors.New("backfill requires a history database")
+	}
+
+	// group the symbols by the range they need
+	for _, t := range trackedTickers {
+		symbol := strings.ToLower(t)
+		if seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+
+		if r, ok := chartRange(symbol, through); ok {
+			ranges[r] = append(ranges[r], symbol)
+		}
+	}
+
+	for r, symbols := range ranges {
+		stock, err := getChart(symbols, r)
+		if err != nil {
+			return err
+		}
+
+		for s, k := range stock {
+			var (
+				bars []priceBar
+				last string
+			)
+
+			for _, c := range k.Chart {
+				bars = append(bars, priceBar{
+					Date:   c.Date,
+					Open:   c.Open,
+					High:   c.High,
+					Low:    c.Low,
+					Close:  c.Close,
+					Volume: c.Volume,
+				})
+				if c.Date > last {
+					last = c.Date
+				}
+			}
+
+			if err = history.putBars(s, bars); err != nil {
+				return err
+			}
+			if last != "" {
+				if err = history.setBackfilled(s, last); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
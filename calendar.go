@@ -0,0 +1,133 @@
+package main
+
+import (
+	"time"
+)
+
+// nthWeekday returns the nth weekday of the month, counting from the end
+// of the month when n is negative.
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	est, _ := time.LoadLocation("America/New_York")
+
+	if n < 0 {
+		last := time.Date(year, month+1, 0, 0, 0, 0, 0, est)
+		return last.AddDate(0, 0, -((int(last.Weekday())-int(weekday)+7)%7 + 7*(-n-1)))
+	}
+
+	first := time.Date(year, month, 1, 0, 0, 0, 0, est)
+	return first.AddDate(0, 0, (int(weekday)-int(first.Weekday())+7)%7+7*(n-1))
+}
+
+// easter returns Easter Sunday of the year using the anonymous Gregorian
+// algorithm.
+func easter(year int) time.Time {
+	est, _ := time.LoadLocation("America/New_York")
+
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+
+	return time.Date(year, time.Month((h+l-7*m+114)/31), (h+l-7*m+114)%31+1, 0, 0, 0, 0, est)
+}
+
+// observed returns the weekday a holiday falling on a weekend is observed
+// on, the Friday before a Saturday or the Monday after a Sunday.
+func observed(t time.Time) time.Time {
+	switch t.Weekday() {
+	case time.Saturday:
+		return t.AddDate(0, 0, -1)
+	case time.Sunday:
+		return t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// marketHolidays returns the dates the NYSE is closed for holidays during
+// the year.
+func marketHolidays(year int) map[string]bool {
+	var (
+		est, _   = time.LoadLocation("America/New_York")
+		holidays = make(map[string]bool)
+		add      = func(t time.Time) { holidays[t.Format(dateFormat)] = true }
+	)
+
+	// New Year's Day falling on a Saturday is not observed
+	if newYear := time.Date(year, time.January, 1, 0, 0, 0, 0, est); newYear.Weekday() != time.Saturday {
+		add(observed(newYear))
+	}
+	add(nthWeekday(year, time.January, time.Monday, 3))
+	add(nthWeekday(year, time.February, time.Monday, 3))
+	add(easter(year).AddDate(0, 0, -2))
+	add(nthWeekday(year, time.May, time.Monday, -1))
+	if year >= 2022 {
+		add(observed(time.Date(year, time.June, 19, 0, 0, 0, 0, est)))
+	}
+	add(observed(time.Date(year, time.July, 4, 0, 0, 0, 0, est)))
+	add(nthWeekday(year, time.September, time.Monday, 1))
+	add(nthWeekday(year, time.November, time.Thursday, 4))
+	add(observed(time.Date(year, time.December, 25, 0, 0, 0, 0, est)))
+
+	return holidays
+}
+
+// tradingDay returns true when the NYSE is open on the date.
+func tradingDay(t time.Time) bool {
+	est, _ := time.LoadLocation("America/New_York")
+	t = t.In(est)
+
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+
+	return !marketHolidays(t.Year())[t.Format(dateFormat)]
+}
+
+// marketHours returns the open and close of the regular trading session
+// on the date, the market closes at 1pm the day before Independence Day,
+// the day after Thanksgiving and on Christmas Eve.
+func marketHours(t time.Time) (time.Time, time.Time) {
+	var (
+		est, _ = time.LoadLocation("America/New_York")
+		ct     = t.In(est)
+		open   = time.Date(ct.Year(), ct.Month(), ct.Day(), 9, 30, 0, 0, est)
+		close  = time.Date(ct.Year(), ct.Month(), ct.Day(), 16, 0, 0, 0, est)
+		early  = time.Date(ct.Year(), ct.Month(), ct.Day(), 13, 0, 0, 0, est)
+	)
+
+	switch {
+	case ct.Month() == time.July && ct.Day() == 3:
+		return open, early
+	case ct.Format(dateFormat) == nthWeekday(ct.Year(), time.November, time.Thursday, 4).AddDate(0, 0, 1).Format(dateFormat):
+		return open, early
+	case ct.Month() == time.December && ct.Day() == 24:
+		return open, early
+	}
+
+	return open, close
+}
+
+// lastTradingDayOf returns true when the date is the last trading day of
+// the week, or of the month when month is set.
+func lastTradingDayOf(t time.Time, month bool) bool {
+	if !tradingDay(t) {
+		return false
+	}
+
+	for next := t.AddDate(0, 0, 1); ; next = next.AddDate(0, 0, 1) {
+		if month && next.Month() != t.Month() {
+			return true
+		}
+		if !month && next.Weekday() == time.Saturday {
+			return true
+		}
+		if tradingDay(next) {
+			return false
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMarketHolidays(t *testing.T) {
+	tests := []struct {
+		year int
+		want []string
+	}{
+		{2022, []string{"2022-01-17", "2022-02-21", "2022-04-15", "2022-05-30", "2022-06-20", "2022-07-04", "2022-09-05", "2022-11-24", "2022-12-26"}},
+		{2024, []string{"2024-01-01", "2024-01-15", "2024-02-19", "2024-03-29", "2024-05-27", "2024-06-19", "2024-07-04", "2024-09-02", "2024-11-28", "2024-12-25"}},
+		{2025, []string{"2025-01-01", "2025-01-20", "2025-02-17", "2025-04-18", "2025-05-26", "2025-06-19", "2025-07-04", "2025-09-01", "2025-11-27", "2025-12-25"}},
+		{2026, []string{"2026-01-01", "2026-01-19", "2026-02-16", "2026-04-03", "2026-05-25", "2026-06-19", "2026-07-03", "2026-09-07", "2026-11-26", "2026-12-25"}},
+	}
+
+	for _, tc := range tests {
+		var got []string
+		for day := range marketHolidays(tc.year) {
+			got = append(got, day)
+		}
+		sort.Strings(got)
+
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("marketHolidays(%d) = %v, want %v", tc.year, got, tc.want)
+		}
+	}
+}
+
+func TestTradingDay(t *testing.T) {
+	tests := []struct {
+		day  string
+		want bool
+	}{
+		{"2024-03-28 12:00", true},
+		{"2024-03-29 12:00", false},
+		{"2024-03-30 12:00", false},
+		{"2024-03-31 12:00", false},
+		{"2024-04-01 12:00", true},
+		{"2026-07-03 12:00", false},
+		{"2021-12-31 12:00", true},
+	}
+
+	for _, tc := range tests {
+		if got := tradingDay(newYork(t, tc.day)); got != tc.want {
+			t.Errorf("tradingDay(%s) = %v, want %v", tc.day, got, tc.want)
+		}
+	}
+}
+
+func TestMarketHours(t *testing.T) {
+	tests := []struct {
+		day   string
+		close string
+	}{
+		{"2024-07-03 12:00", "2024-07-03 13:00"},
+		{"2024-11-29 12:00", "2024-11-29 13:00"},
+		{"2024-12-24 12:00", "2024-12-24 13:00"},
+		{"2024-12-23 12:00", "2024-12-23 16:00"},
+		{"2025-11-28 12:00", "2025-11-28 13:00"},
+		{"2025-11-26 12:00", "2025-11-26 16:00"},
+	}
+
+	for _, tc := range tests {
+		open, close := marketHours(newYork(t, tc.day))
+		if !open.Equal(newYork(t, tc.day[:10]+" 09:30")) || !close.Equal(newYork(t, tc.close)) {
+			t.Errorf("marketHours(%s) = %s, %s, want close at %s", tc.day, open, close, tc.close)
+		}
+	}
+}
+
+func TestLastTradingDayOf(t *testing.T) {
+	tests := []struct {
+		day   string
+		month bool
+		want  bool
+	}{
+		{"2024-05-31 12:00", true, true},
+		{"2024-05-30 12:00", true, false},
+		{"2024-03-28 12:00", true, true},
+		{"2024-03-28 12:00", false, true},
+		{"2024-03-29 12:00", false, false},
+		{"2024-11-27 12:00", false, false},
+		{"2024-11-29 12:00", false, true},
+		{"2025-04-17 12:00", false, true},
+		{"2026-07-02 12:00", false, true},
+		{"2024-08-30 12:00", true, true},
+	}
+
+	for _, tc := range tests {
+		if got := lastTradingDayOf(newYork(t, tc.day), tc.month); got != tc.want {
+			t.Errorf("lastTradingDayOf(%s, %v) = %v, want %v", tc.day, tc.month, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"time"
+
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+// pngChart returns a PNG line chart of the values, the area between the
+// line and zero is filled when fill is set.
+func pngChart(values []float64, width int, height int, stroke color.RGBA, fill bool) ([]byte, error) {
+	var (
+		buf  bytes.Buffer
+		low  = math.Inf(1)
+		high = math.Inf(-1)
+		img  = image.NewRGBA(image.Rect(0, 0, width, height))
+		area = color.RGBA{
+			R: uint8((int(stroke.R) + 2*255) / 3),
+			G: uint8((int(stroke.G) + 2*255) / 3),
+			B: uint8((int(stroke.B) + 2*255) / 3),
+			A: 255,
+		}
+	)
+
+	if len(values) < 2 {
+		return nil, nil
+	}
+
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+	if fill {
+		low = math.Min(low, 0)
+		high = math.Max(high, 0)
+	}
+	if high == low {
+		high = low + 1
+	}
+
+	// keep the line inside the image at the lowest and highest values
+	y := func(v float64) float64 {
+		return 1 + (high-v)/(high-low)*float64(height-3)
+	}
+	zero := int(math.Round(y(0)))
+
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+
+	// interpolate the value at every column so the line has no gaps
+	previous := -1
+	for x := 0; x < width; x++ {
+		pos := float64(x) / float64(width-1) * float64(len(values)-1)
+		i := int(pos)
+		if i >= len(values)-1 {
+			i = len(values) - 2
+		}
+		row := int(math.Round(y(values[i] + (values[i+1]-values[i])*(pos-float64(i)))))
+
+		if fill {
+			from, to := row, zero
+			if from > to {
+				from, to = to, from
+			}
+			for r := from; r <= to; r++ {
+				img.SetRGBA(x, r, area)
+			}
+		}
+
+		from, to := row, row
+		if previous >= 0 {
+			from, to = int(math.Min(float64(row), float64(previous))), int(math.Max(float64(row), float64(previous)))
+		}
+		for r := from; r <= to+1; r++ {
+			img.SetRGBA(x, r, stroke)
+		}
+		previous = row
+	}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// intradayPrices returns the prices of the symbol recorded in the
+// history database during the current or last trading session.
+func intradayPrices(symbol string) []float64 {
+	var (
+		prices []float64
+		est, _ = time.LoadLocation("America/New_York")
+		now    = time.Now().In(est)
+	)
+
+	// look back over weekends and holidays to the last session recorded
+	for d := 0; d < 7 && len(prices) == 0; d++ {
+		day := now.AddDate(0, 0, -d)
+		open := time.Date(day.Year(), day.Month(), day.Day(), 9, 30, 0, 0, est)
+		ticks, err := history.ticks(symbol, open, time.Date(day.Year(), day.Month(), day.Day(), 16, 0, 0, 0, est))
+		if err != nil {
+			return prices
+		}
+		for _, t := range ticks {
+			if t.Price > 0 {
+				prices = append(prices, t.Price)
+			}
+		}
+	}
+
+	return prices
+}
+
+// chartImage returns the chart as an inline image part of an e-mail
+// message.
+func chartImage(name string, chart []byte) mailPart {
+	return mailPart{
+		Name:        name + ".png",
+		ContentType: "image/png",
+		ContentID:   "chart-" + strings.ToLower(name) + "@stockwatch",
+		Data:        chart,
+	}
+}
+
+// stockChart returns the intraday chart of the symbol, drawn in green
+// or red for the change of the day.
+func stockChart(symbol string, change float64) (mailPart, bool) {
+	stroke := color.RGBA{R: 40, G: 167, B: 69, A: 255}
+	if change < 0 {
+		stroke = color.RGBA{R: 220, G: 53, B: 69, A: 255}
+	}
+
+	chart, err := pngChart(intradayPrices(symbol), 600, 150, stroke, false)
+	if err != nil || chart == nil {
+		return mailPart{}, false
+	}
+
+	return chartImage(symbol, chart), true
+}
+
+// equityChart returns the chart of the total value of all accounts over
+// the last 90 days.
+func equityChart() (mailPart, bool) {
+	_, values, err := history.equityCurve(startOfDay(time.Now()).AddDate(0, 0, -90))
+	if err != nil {
+		return mailPart{}, false
+	}
+
+	chart, err := pngChart(values, 600, 150, color.RGBA{R: 0, G: 123, B: 255, A: 255}, false)
+	if err != nil || chart == nil {
+		return mailPart{}, false
+	}
+
+	return chartImage("portfolio", chart), true
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"encoding/json"
+	"net/url"
+)
+
+// slackHeaderLimit and slackSectionLimit are the most characters Slack
+// accepts in the text of a header and a section block, and
+// telegramMessageLimit the most Telegram accepts in a message. Longer text
+// causes the whole message to be rejected.
+const (
+	slackHeaderLimit     = 150
+	slackSectionLimit    = 3000
+	telegramMessageLimit = 4096
+)
+
+// slackEscaper escapes the characters Slack treats as control characters
+// in mrkdwn text.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// truncate shortens the text to at most limit characters, marking the
+// cut with an ellipsis.
+func truncate(text string, limit int) string {
+	r := []rune(text)
+	if len(r) <= limit {
+		return text
+	}
+	return string(r[:limit-1]) + "…"
+}
+
+// chunk groups the lines into chunks of at most limit characters when
+// joined by newlines, lines longer than the limit are truncated. There is
+// always at least one chunk.
+func chunk(lines []string, limit int) [][]string {
+	var (
+		chunks [][]string
+		size   int
+	)
+
+	for _, l := range lines {
+		l = truncate(l, limit)
+		n := len([]rune(l))
+		if len(chunks) == 0 || size+1+n > limit {
+			chunks = append(chunks, nil)
+			size = -1
+		}
+		chunks[len(chunks)-1] = append(chunks[len(chunks)-1], l)
+		size = size + 1 + n
+	}
+	if len(chunks) == 0 {
+		chunks = append(chunks, nil)
+	}
+
+	return chunks
+}
+
+// table returns the stocks or alerts of the notification as lines of a
+// fixed width table.
+func (n notification) table() []string {
+	var lines []string
+
+	if n.Kind == "alert" {
+		for _, e := range n.Alerts {
+			lines = append(lines, e.Time.Format(timeFormat)+" "+e.Message)
+		}
+		return lines
+	}
+
+	lines = append(lines, alignLeft("Symbol", 8)+alignRight("Price", 11)+alignRight("Change", 10)+alignRight("Gain/Loss", 13))
+	for _, s := range n.Stocks {
+		lines = append(lines, alignLeft(strings.ToUpper(s.Symbol), 8)+
+			alignRight(strconv.FormatFloat(s.Price, 'f', 2, 64), 11)+
+			alignRight(strconv.FormatFloat(s.Change, 'f', 2, 64), 10)+
+			alignRight(strconv.FormatFloat(s.GainLoss, 'f', 2, 64), 13))
+	}
+
+	return lines
+}
+
+// totals returns the labelled portfolio totals of a summary.
+func (n notification) totals() [][2]string {
+	var totals [][2]string
+
+	if n.Kind != "summary" {
+		return totals
+	}
+
+	totals = append(totals, [2]string{"Total Gain/Loss (" + n.BaseCurrency + ")", strconv.FormatFloat(n.TotalGainLoss, 'f', 2, 64)})
+	if len(config.Accounts) > 0 {
+		totals = append(totals, [2]string{"Cash Balance", strconv.FormatFloat(n.Cash, 'f', 2, 64)})
+		totals = append(totals, [2]string{"Account Value", strconv.FormatFloat(n.AccountValue, 'f', 2, 64)})
+	}
+	if n.Incomplete {
+		totals = append(totals, [2]string{"Note", "holdings without an exchange rate are left out of the totals"})
+	}
+
+	return totals
+}
+
+// text returns the notification as plain text.
+func (n notification) text() string {
+	text := n.Subject + "\n\n" + strings.Join(n.table(), "\n") + "\n"
+	for _, t := range n.totals() {
+		text += "\n" + t[0] + ": " + t[1]
+	}
+	return text
+}
+
+// html returns the notification as an HTML table of the stocks or a list
+// of the alerts.
+func (n notification) html() string {
+	body := "<h4>" + html.EscapeString(n.Subject) + "</h4>\n"
+
+	if n.Kind == "alert" {
+		body += "<ul>\n"
+		for _, e := range n.Alerts {
+			body += "<li>" + e.Time.Format(timeFormat) + " " + html.EscapeString(e.Message) + "</li>\n"
+		}
+		return body + "</ul>"
+	}
+
+	body += "<table>\n<tr><th>Symbol</th><th>Price</th><th>Change</th><th>Gain/Loss</th></tr>\n"
+	for _, s := range n.Stocks {
+		body += "<tr><td>" + html.EscapeString(strings.ToUpper(s.Symbol)) + "</td>" +
+			"<td>" + strconv.FormatFloat(s.Price, 'f', 2, 64) + "</td>" +
+			"<td>" + strconv.FormatFloat(s.Change, 'f', 2, 64) + "</td>" +
+			"<td>" + strconv.FormatFloat(s.GainLoss, 'f', 2, 64) + "</td></tr>\n"
+	}
+	body += "</table>"
+	for _, t := range n.totals() {
+		body += "\n<br><b>" + html.EscapeString(t[0]) + ":</b> " + t[1]
+	}
+
+	return body
+}
+
+// send posts the notification as Block Kit blocks, the stocks or alerts
+// are shown as preformatted tables split across sections within the size
+// limit followed by the totals as fields.
+func (s *slackNotifier) send(n notification) error {
+	var (
+		fields []map[string]string
+		lines  []string
+	)
+
+	blocks := []map[string]interface{}{
+		{"type": "header", "text": map[string]string{"type": "plain_text", "text": truncate(n.Subject, slackHeaderLimit)}},
+	}
+	for _, l := range n.table() {
+		lines = append(lines, slackEscaper.Replace(l))
+	}
+	for _, c := range chunk(lines, slackSectionLimit-6) {
+		blocks = append(blocks, map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": "```" + strings.Join(c, "\n") + "```"}})
+	}
+	for _, t := range n.totals() {
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": "*" + slackEscaper.Replace(t[0]) + "*\n" + slackEscaper.Replace(t[1])})
+	}
+	if len(fields) > 0 {
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields})
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"text": n.Subject, "blocks": blocks})
+	if err != nil {
+		return err
+	}
+
+	return sendWithRetry(s.config, "POST", s.config.URL, nil, "application/json", payload)
+}
+
+// send sends the notification to the room as a message with an HTML
+// formatted body.
+func (m *matrixNotifier) send(n notification) error {
+	var headers httpHeader
+
+	payload, err := json.Marshal(map[string]string{
+		"msgtype":        "m.text",
+		"body":           n.text(),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": n.html(),
+	})
+	if err != nil {
+		return err
+	}
+
+	headers = append(headers, struct {
+		Name  string
+		Value string
+	}{Name: "Authorization", Value: "Bearer " + m.config.Token})
+
+	// the transaction id makes retries of the same message idempotent
+	txn := "stockwatch" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	endpoint := strings.TrimRight(m.config.URL, "/") + "/_matrix/client/v3/rooms/" + url.PathEscape(m.config.Room) + "/send/m.room.message/" + txn
+
+	return sendWithRetry(m.config, "PUT", endpoint, headers, "application/json", payload)
+}
+
+// send sends the notification to the chat, Telegram does not support
+// tables so the stocks or alerts are shown preformatted, split across as
+// many messages as the size limit requires with the totals in the last.
+func (t *telegramNotifier) send(n notification) error {
+	var (
+		lines  []string
+		totals string
+		base   = t.config.URL
+	)
+
+	if base == "" {
+		base = "https://api.telegram.org"
+	}
+
+	header := "<b>" + html.EscapeString(truncate(n.Subject, 256)) + "</b>\n<pre>"
+	for _, l := range n.table() {
+		lines = append(lines, html.EscapeString(l))
+	}
+	for _, v := range n.totals() {
+		totals += "\n<b>" + html.EscapeString(v[0]) + ":</b> " + html.EscapeString(v[1])
+	}
+
+	chunks := chunk(lines, telegramMessageLimit-len([]rune(header+"</pre>"+totals)))
+	for i, c := range chunks {
+		text := header + strings.Join(c, "\n") + "</pre>"
+		if i == len(chunks)-1 {
+			text += totals
+		}
+
+		payload, err := json.Marshal(map[string]string{
+			"chat_id":    t.config.Chat,
+			"text":       text,
+			"parse_mode": "HTML",
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = sendWithRetry(t.config, "POST", strings.TrimRight(base, "/")+"/bot"+t.config.Token+"/sendMessage", nil, "application/json", payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
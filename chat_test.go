@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// chatRequest is a request received by the chat stand-in server.
+type chatRequest struct {
+	Method        string
+	Path          string
+	Authorization string
+	ContentType   string
+	Body          map[string]interface{}
+}
+
+// chatServer starts a local stand-in for a chat service that records the
+// requests it receives.
+func chatServer(t *testing.T) (*httptest.Server, *[]chatRequest) {
+	var requests []chatRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := chatRequest{
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Authorization: r.Header.Get("Authorization"),
+			ContentType:   r.Header.Get("Content-Type"),
+		}
+		buffer, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(buffer, &req.Body); err != nil {
+			t.Errorf("payload is not JSON: %v", err)
+		}
+		requests = append(requests, req)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+// chatSend sends the notification with a notifier of the configuration
+// and returns the request the stand-in server received.
+func chatSend(t *testing.T, c notifierConfig, n notification) chatRequest {
+	srv, requests := chatServer(t)
+	retries := 0
+	c.URL = srv.URL + c.URL
+	c.Retries = &retries
+
+	nt, err := newNotifier(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nt.send(n); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*requests))
+	}
+
+	return (*requests)[0]
+}
+
+// chatSummary is the summary the chat tests send.
+var chatSummary = notification{
+	Kind:          "summary",
+	Subject:       "Stock Report",
+	BaseCurrency:  "USD",
+	TotalGainLoss: 12.5,
+	Stocks:        []summaryStock{{Symbol: "amd", Price: 30.12, Change: -0.5, GainLoss: 12.5}},
+}
+
+func TestSlackPayload(t *testing.T) {
+	config = configuration{}
+
+	tests := []struct {
+		subject string
+		header  string
+	}{
+		{"Stock Report", "Stock Report"},
+		{strings.Repeat("a", 150), strings.Repeat("a", 150)},
+		{strings.Repeat("é", 200), strings.Repeat("é", 149) + "…"},
+	}
+
+	for _, tc := range tests {
+		n := chatSummary
+		n.Subject = tc.subject
+
+		req := chatSend(t, notifierConfig{Name: "s", Type: "slack", URL: "/hook"}, n)
+		if req.Method != "POST" || req.Path != "/hook" || req.ContentType != "application/json" {
+			t.Errorf("request %s %s %s", req.Method, req.Path, req.ContentType)
+		}
+		if req.Body["text"] != tc.subject {
+			t.Errorf("text = %v, want %q", req.Body["text"], tc.subject)
+		}
+
+		blocks := req.Body["blocks"].([]interface{})
+		header := blocks[0].(map[string]interface{})
+		text := header["text"].(map[string]interface{})["text"].(string)
+		if header["type"] != "header" || text != tc.header {
+			t.Errorf("header = %q, want %q", text, tc.header)
+		}
+		if utf8.RuneCountInString(text) > slackHeaderLimit {
+			t.Errorf("header has %d characters", utf8.RuneCountInString(text))
+		}
+
+		table := blocks[1].(map[string]interface{})["text"].(map[string]interface{})["text"].(string)
+		if !strings.Contains(table, "AMD") || !strings.HasPrefix(table, "```") {
+			t.Errorf("table = %q", table)
+		}
+	}
+}
+
+func TestMatrixPayload(t *testing.T) {
+	config = configuration{}
+
+	req := chatSend(t, notifierConfig{Name: "m", Type: "matrix", Token: "tok", Room: "!abc:example.org"}, chatSummary)
+	if req.Method != "PUT" || !strings.HasPrefix(req.Path, "/_matrix/client/v3/rooms/!abc:example.org/send/m.room.message/stockwatch") {
+		t.Errorf("request %s %s", req.Method, req.Path)
+	}
+	if req.Authorization != "Bearer tok" {
+		t.Errorf("authorization = %q", req.Authorization)
+	}
+	if req.Body["msgtype"] != "m.text" || req.Body["format"] != "org.matrix.custom.html" {
+		t.Errorf("body = %v", req.Body)
+	}
+	if !strings.Contains(req.Body["body"].(string), "AMD") || !strings.Contains(req.Body["formatted_body"].(string), "<td>AMD</td>") {
+		t.Errorf("body = %v", req.Body)
+	}
+}
+
+func TestTelegramPayload(t *testing.T) {
+	config = configuration{}
+
+	tests := []struct {
+		n    notification
+		want string
+	}{
+		{chatSummary, "<b>Stock Report</b>\n<pre>"},
+		{notification{Kind: "alert", Subject: "Stock Alert", Alerts: []alertEvent{{Rule: "a", Message: "AMD <up>"}}}, "AMD &lt;up&gt;"},
+	}
+
+	for _, tc := range tests {
+		req := chatSend(t, notifierConfig{Name: "t", Type: "telegram", Token: "123:x", Chat: "42"}, tc.n)
+		if req.Method != "POST" || req.Path != "/bot123:x/sendMessage" {
+			t.Errorf("request %s %s", req.Method, req.Path)
+		}
+		if req.Body["chat_id"] != "42" || req.Body["parse_mode"] != "HTML" {
+			t.Errorf("body = %v", req.Body)
+		}
+		if !strings.Contains(req.Body["text"].(string), tc.want) {
+			t.Errorf("text = %q, want it to contain %q", req.Body["text"], tc.want)
+		}
+	}
+}
+
+// chatLong returns a summary with a table too long for a single message.
+func chatLong() notification {
+	n := chatSummary
+	n.Stocks = nil
+	for i := 0; i < 300; i++ {
+		n.Stocks = append(n.Stocks, summaryStock{Symbol: "s&p" + strconv.Itoa(i), Price: 1, GainLoss: 1})
+	}
+	return n
+}
+
+func TestSlackLimits(t *testing.T) {
+	config = configuration{}
+
+	n := chatLong()
+	req := chatSend(t, notifierConfig{Name: "s", Type: "slack", URL: "/hook"}, n)
+
+	var rows int
+	blocks := req.Body["blocks"].([]interface{})
+	for _, b := range blocks[1 : len(blocks)-1] {
+		text := b.(map[string]interface{})["text"].(map[string]interface{})["text"].(string)
+		if utf8.RuneCountInString(text) > slackSectionLimit {
+			t.Errorf("section has %d characters", utf8.RuneCountInString(text))
+		}
+		if strings.Contains(strings.Replace(text, "&amp;", "", -1), "&") {
+			t.Errorf("section is not escaped: %q", text)
+		}
+		rows = rows + strings.Count(text, "S&amp;P")
+	}
+	if len(blocks) < 4 || rows != len(n.Stocks) {
+		t.Errorf("got %d blocks with %d rows, want the %d rows split across sections", len(blocks), rows, len(n.Stocks))
+	}
+
+	alert := notification{Kind: "alert", Subject: "Stock Alert", Alerts: []alertEvent{{Rule: "a", Message: "AMD <@here> & <!channel>"}}}
+	req = chatSend(t, notifierConfig{Name: "s", Type: "slack", URL: "/hook"}, alert)
+	text := req.Body["blocks"].([]interface{})[1].(map[string]interface{})["text"].(map[string]interface{})["text"].(string)
+	if !strings.Contains(text, "AMD &lt;@here&gt; &amp; &lt;!channel&gt;") {
+		t.Errorf("alert = %q, want it escaped", text)
+	}
+}
+
+func TestTelegramLimits(t *testing.T) {
+	config = configuration{}
+
+	srv, requests := chatServer(t)
+	retries := 0
+	nt, err := newNotifier(notifierConfig{Name: "t", Type: "telegram", Token: "123:x", Chat: "42", URL: srv.URL, Retries: &retries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = nt.send(chatLong()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*requests) < 2 {
+		t.Fatalf("got %d messages, want the summary split", len(*requests))
+	}
+	var rows int
+	for i, req := range *requests {
+		text := req.Body["text"].(string)
+		if utf8.RuneCountInString(text) > telegramMessageLimit {
+			t.Errorf("message %d has %d characters", i, utf8.RuneCountInString(text))
+		}
+		if !strings.HasPrefix(text, "<b>Stock Report</b>\n<pre>") {
+			t.Errorf("message %d = %q", i, text[:40])
+		}
+		if total := strings.Contains(text, "Total Gain/Loss"); total != (i == len(*requests)-1) {
+			t.Errorf("message %d has the totals %v", i, total)
+		}
+		rows = rows + strings.Count(text, "S&amp;P")
+	}
+	if rows != 300 {
+		t.Errorf("got %d rows, want 300", rows)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCommand runs a command provided after the command line options.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "performance":
+		return commandPerformance()
+	case "backfill":
+		return backfillHistory()
+	case "export":
+		return commandExport(args[1:])
+	case "realized":
+		return commandRealized(args[1:])
+	case "form8949":
+		return commandForm8949(args[1:])
+	case "alerts":
+		return commandAlerts()
+	case "reports":
+		return commandReports()
+	case "mailqueue":
+		return commandMailQueue(args[1:])
+	}
+
+	return errors.New("unknown command \"" + args[0] + "\"")
+}
+
+// commandPerformance records the current prices and displays the returns
+// of every account and position in the ledger.
+func commandPerformance() error {
+	if len(config.Accounts) == 0 {
+		return errors.New("performance requires accounts in the configuration file")
+	}
+
+	s, err := getPrices()
+	if err != nil {
+		return err
+	}
+	if err = history.record(s); err != nil {
+		return err
+	}
+
+	fmt.Print(displayPerformance(time.Now()))
+
+	return nil
+}
+
+// commandYear returns the tax year provided to a command, defaulting to
+// the current year.
+func commandYear(args []string) (int, error) {
+	if len(args) == 0 {
+		return time.Now().Year(), nil
+	}
+
+	year, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, errors.New("year \"" + args[0] + "\" is not numeric")
+	}
+
+	return year, nil
+}
+
+// commandRealized displays the gains/losses realized during the year.
+func commandRealized(args []string) error {
+	year, err := commandYear(args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(displayRealized(year))
+
+	return nil
+}
+
+// commandForm8949 writes the gains/losses realized during the year to
+// standard output as CSV.
+func commandForm8949(args []string) error {
+	year, err := commandYear(args)
+	if err != nil {
+		return err
+	}
+
+	return writeForm8949(os.Stdout, year)
+}
+
+// commandAlerts evaluates every alert rule against the current stock data
+// without reporting them.
+func commandAlerts() error {
+	if len(config.Alerts) == 0 {
+		return errors.New("alerts requires alert rules in the configuration file")
+	}
+
+	s, err := getPrices()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range config.Alerts {
+		reference := r.Price
+		if k, ok := quote(s, r.Ticker); ok && reference == 0 {
+			reference = k.Price
+		}
+
+		active, message := r.check(s, reference)
+		if message == "" {
+			message = "no data for " + strings.ToUpper(r.Ticker)
+		}
+		fmt.Println(r.Name + ": " + strconv.FormatBool(active) + ": " + message)
+	}
+
+	return nil
+}
+
+// commandReports displays the schedule of every report with the time it
+// last ran and will next run.
+func commandReports() error {
+	for _, r := range reports() {
+		last, next := "never", "never"
+		if t := history.lastReport(r.Name); !t.IsZero() {
+			last = t.Local().Format(timeFormat)
+		}
+		if t, ok := r.next(time.Now()); ok {
+			next = t.Local().Format(timeFormat)
+		}
+		fmt.Println(r.Name + ": " + r.Schedule + ": last " + last + ", next " + next)
+	}
+
+	return nil
+}
+
+// commandMailQueue lists the queued e-mail, delivers it now with flush or
+// discards it with purge, limited to the message ids provided.
+func commandMailQueue(args []string) error {
+	var action = "list"
+
+	if cmdLnEmailQueue == "" {
+		return errors.New("mailqueue requires the mail queue directory")
+	}
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	queue, err := loadMailQueue()
+	if err != nil {
+		return err
+	}
+
+	selected := func(q queuedMail) bool {
+		if len(args) == 0 {
+			return true
+		}
+		for _, id := range args {
+			if id == q.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch action {
+	case "list":
+		for _, q := range queue {
+			if !selected(q) {
+				continue
+			}
+			fmt.Println(q.ID + ": " + q.Subject + ": to " + strings.Join(q.Recipients, ", ") + ": queued " + q.Created.Local().Format(timeFormat) +
+				", attempts " + strconv.Itoa(q.Attempts) + ", next " + q.Next.Local().Format(timeFormat))
+			if q.Error != "" {
+				fmt.Println("\t" + q.Error)
+			}
+		}
+	case "flush":
+		if cmdLnEmailHost == "" {
+			return errors.New("flush requires the e-mail server host")
+		}
+		for i := range queue {
+			if !selected(queue[i]) {
+				continue
+			}
+			if !queue[i].claim() {
+				fmt.Println(queue[i].ID + ": being delivered")
+				continue
+			}
+			if err = queue[i].attempt(mailHost()); err != nil {
+				fmt.Println(queue[i].ID + ": " + err.Error())
+				continue
+			}
+			fmt.Println(queue[i].ID + ": delivered")
+		}
+	case "purge":
+		for _, q := range queue {
+			if !selected(q) {
+				continue
+			}
+			if !q.claim() {
+				fmt.Println(q.ID + ": being delivered")
+				continue
+			}
+			if err = q.remove(); err != nil {
+				return err
+			}
+			fmt.Println(q.ID + ": removed")
+		}
+	default:
+		return errors.New("unknown mailqueue action \"" + action + "\"")
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/TheSp1der/goerror"
+	"github.com/godbus/dbus/v5"
+)
+
+// desktopUnavailable warns once that there is no session bus or
+// notification service to show desktop notifications with.
+var desktopUnavailable sync.Once
+
+// desktopUrgency returns the freedesktop notification urgency (0 low, 1
+// normal, 2 critical) of an alert severity.
+func desktopUrgency(severity string) byte {
+	switch severity {
+	case "low":
+		return 0
+	case "urgent":
+		return 2
+	}
+	return 1
+}
+
+// send shows each message of the notification on the desktop with an
+// icon for gains and losses. When there is no session bus or
+// notification service, for example when running without a desktop
+// session, messages are dropped after a single warning.
+func (d *desktopNotifier) send(n notification) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		desktopUnavailable.Do(func() {
+			goerror.Warning(errors.New("desktop notifications are unavailable: " + err.Error()))
+		})
+		return nil
+	}
+
+	obj := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
+	for _, m := range pushMessages(n) {
+		icon := "dialog-information"
+		switch m.Move {
+		case "up":
+			icon = "go-up"
+		case "down":
+			icon = "go-down"
+		}
+
+		call := obj.Call("org.freedesktop.Notifications.Notify", 0,
+			"stockwatch",
+			uint32(0),
+			icon,
+			m.Title,
+			m.Message,
+			[]string{},
+			map[string]dbus.Variant{"urgency": dbus.MakeVariant(desktopUrgency(m.Severity))},
+			int32(-1),
+		)
+		if e, ok := call.Err.(dbus.Error); ok && e.Name == "org.freedesktop.DBus.Error.ServiceUnknown" {
+			desktopUnavailable.Do(func() {
+				goerror.Warning(errors.New("desktop notifications are unavailable: " + e.Error()))
+			})
+			return nil
+		}
+		if call.Err != nil {
+			return call.Err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+
+	"github.com/TheSp1der/goerror"
+)
+
+// historyColumns returns the columns exported for the interval.
+func historyColumns(interval string) []exportColumn {
+	if interval == "ticks" {
+		return []exportColumn{
+			{Name: "symbol", Type: "string"},
+			{Name: "time", Type: "timestamp"},
+			{Name: "price", Type: "double"},
+			{Name: "open", Type: "double"},
+			{Name: "high", Type: "double"},
+			{Name: "low", Type: "double"},
+			{Name: "close", Type: "double"},
+			{Name: "latestVolume", Type: "int64"},
+			{Name: "marketCap", Type: "int64"},
+			{Name: "peRatio", Type: "double"},
+		}
+	}
+
+	return []exportColumn{
+		{Name: "symbol", Type: "string"},
+		{Name: "date", Type: "string"},
+		{Name: "open", Type: "double"},
+		{Name: "high", Type: "double"},
+		{Name: "low", Type: "double"},
+		{Name: "close", Type: "double"},
+		{Name: "latestVolume", Type: "int64"},
+		{Name: "marketCap", Type: "int64"},
+		{Name: "peRatio", Type: "double"},
+	}
+}
+
+// newHistoryWriter returns a writer for the format.
+func newHistoryWriter(w io.Writer, format string, columns []exportColumn) (historyWriter, error) {
+	switch format {
+	case "csv":
+		c := &csvWriter{w: csv.NewWriter(w), columns: columns}
+		var header []string
+		for _, col := range columns {
+			header = append(header, col.Name)
+		}
+		return c, c.w.Write(header)
+	case "jsonl":
+		return &jsonWriter{w: w, columns: columns}, nil
+	case "parquet":
+		return newParquetWriter(w, columns)
+	}
+
+	return nil, errors.New("unknown export format \"" + format + "\"")
+}
+
+// write writes the row as a CSV record.
+func (c *csvWriter) write(row []interface{}) error {
+	var record []string
+
+	for i, v := range row {
+		switch c.columns[i].Type {
+		case "double":
+			record = append(record, strconv.FormatFloat(v.(float64), 'f', -1, 64))
+		case "int64":
+			record = append(record, strconv.FormatInt(v.(int64), 10))
+		case "timestamp":
+			record = append(record, v.(time.Time).Format(time.RFC3339))
+		default:
+			record = append(record, v.(string))
+		}
+	}
+
+	return c.w.Write(record)
+}
+
+// close flushes any buffered records.
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// write writes the row as a JSON object on its own line.
+func (j *jsonWriter) write(row []interface{}) error {
+	obj := make(map[string]interface{})
+	for i, v := range row {
+		obj[j.columns[i].Name] = v
+	}
+
+	buffer, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	_, err = j.w.Write(append(buffer, '\n'))
+	return err
+}
+
+// close has nothing to flush for JSON Lines.
+func (j *jsonWriter) close() error {
+	return nil
+}
+
+// exportHistory writes the daily bars or intraday ticks of the symbols
+// between the dates inclusive to the writer in the format.
+func exportHistory(w io.Writer, symbols []string, from time.Time, to time.Time, interval string, format string) error {
+	if interval != "daily" && interval != "ticks" {
+		return errors.New("unknown export interval \"" + interval + "\"")
+	}
+
+	columns := historyColumns(interval)
+	out, err := newHistoryWriter(w, format, columns)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range symbols {
+		symbol := strings.TrimSpace(strings.ToLower(s))
+
+		if interval == "ticks" {
+			ticks, err := history.ticks(symbol, startOfDay(from), startOfDay(to).AddDate(0, 0, 1).Add(-1))
+			if err != nil {
+				return err
+			}
+			for _, t := range ticks {
+				if err = out.write([]interface{}{symbol, t.Time, t.Price, t.Open, t.High, t.Low, t.Close, t.Volume, t.MarketCap, t.PeRatio}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		bars, err := history.bars(symbol, from, to)
+		if err != nil {
+			return err
+		}
+		for _, b := range bars {
+			if err = out.write([]interface{}{symbol, b.Date, b.Open, b.High, b.Low, b.Close, b.Volume, b.MarketCap, b.PeRatio}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return out.close()
+}
+
+// exportRange parses the dates of an export, defaulting to the year up
+// to today.
+func exportRange(from string, to string) (time.Time, time.Time, error) {
+	var (
+		err   error
+		start = startOfDay(time.Now()).AddDate(-1, 0, 0)
+		end   = startOfDay(time.Now())
+	)
+
+	if from != "" {
+		if start, err = time.ParseInLocation(dateFormat, from, time.Local); err != nil {
+			return start, end, errors.New("from date \"" + from + "\" is not in the form YYYY-MM-DD")
+		}
+	}
+	if to != "" {
+		if end, err = time.ParseInLocation(dateFormat, to, time.Local); err != nil {
+			return start, end, errors.New("to date \"" + to + "\" is not in the form YYYY-MM-DD")
+		}
+	}
+
+	return start, end, nil
+}
+
+// exportSymbols splits a comma separated list of symbols, defaulting to
+// every tracked ticker.
+func exportSymbols(list string) []string {
+	if list == "" {
+		return trackedTickers
+	}
+	return strings.Split(list, ",")
+}
+
+// commandExport writes price history to a file or standard output.
+func commandExport(args []string) error {
+	var (
+		err   error
+		out   io.Writer = os.Stdout
+		flags           = flag.NewFlagSet("export", flag.ContinueOnError)
+	)
+
+	symbols := flags.String("symbols", "", "Comma separated list of symbols to export, defaults to all tracked tickers.")
+	from := flags.String("from", "", "First date to export in the form YYYY-MM-DD, defaults to one year ago.")
+	to := flags.String("to", "", "Last date to export in the form YYYY-MM-DD, defaults to today.")
+	format := flags.String("format", "csv", "Export format: csv, jsonl or parquet.")
+	interval := flags.String("interval", "daily", "Export daily bars (daily) or intraday ticks (ticks).")
+	file := flags.String("out", "", "File to write, defaults to standard output.")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+
+	start, end, err := exportRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	return exportHistory(out, exportSymbols(*symbols), start, end, *interval, *format)
+}
+
+// webExport streams price history in the requested format.
+func webExport(resp http.ResponseWriter, req *http.Request) {
+	var (
+		query    = req.URL.Query()
+		format   = query.Get("format")
+		interval = query.Get("interval")
+		types    = map[string]string{
+			"csv":     "text/csv",
+			"jsonl":   "application/x-ndjson",
+			"parquet": "application/vnd.apache.parquet",
+		}
+	)
+
+	if req.Method != "GET" {
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if format == "" {
+		format = "csv"
+	}
+	if interval == "" {
+		interval = "daily"
+	}
+	if _, ok := types[format]; !ok {
+		http.Error(resp, "unknown export format \""+format+"\"", http.StatusBadRequest)
+		return
+	}
+	if interval != "daily" && interval != "ticks" {
+		http.Error(resp, "unknown export interval \""+interval+"\"", http.StatusBadRequest)
+		return
+	}
+
+	start, end, err := exportRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp.Header().Add("Content-Type", types[format])
+	resp.Header().Add("Content-Disposition", "attachment; filename=\"stockwatch-"+interval+"."+format+"\"")
+	if err = exportHistory(resp, exportSymbols(query.Get("symbols")), start, end, interval, format); err != nil {
+		goerror.Warning(err)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// exprOperators are the operators of alert expressions, longest first so
+// two character operators are matched before their prefixes.
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")"}
+
+// exprError returns an error describing a problem at a position of an
+// expression.
+func exprError(message string, pos int) error {
+	return errors.New(message + " at position " + strconv.Itoa(pos+1))
+}
+
+// tokenize splits an expression into tokens.
+func tokenize(input string) ([]exprToken, error) {
+	var tokens []exprToken
+
+	for i := 0; i < len(input); {
+		c := input[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			start := i
+			for i < len(input) && (input[i] >= '0' && input[i] <= '9' || input[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{Kind: "number", Text: input[start:i], Pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			for i < len(input) && input[i] != c {
+				i++
+			}
+			if i >= len(input) {
+				return tokens, exprError("unterminated string", start)
+			}
+			tokens = append(tokens, exprToken{Kind: "string", Text: input[start+1 : i], Pos: start})
+			i++
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_':
+			start := i
+			for i < len(input) && (input[i] >= 'a' && input[i] <= 'z' || input[i] >= 'A' && input[i] <= 'Z' || input[i] >= '0' && input[i] <= '9' || input[i] == '_' || input[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{Kind: "ident", Text: input[start:i], Pos: start})
+		default:
+			found := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(input[i:], op) {
+					tokens = append(tokens, exprToken{Kind: "op", Text: op, Pos: i})
+					i = i + len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return tokens, exprError("unexpected character \""+string(c)+"\"", i)
+			}
+		}
+	}
+
+	return append(tokens, exprToken{Kind: "end", Pos: len(input)}), nil
+}
+
+// parseExpr parses and type checks an alert expression, which must
+// evaluate to true or false.
+func parseExpr(input string) (*exprNode, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.Kind != "end" {
+		return nil, exprError("unexpected \""+t.Text+"\"", t.Pos)
+	}
+	if n.Kind != "bool" {
+		return nil, errors.New("expression must be a comparison, not a " + n.Kind)
+	}
+
+	return n, nil
+}
+
+// peek returns the current token.
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+// accept moves past the current token when it is one of the operators.
+func (p *exprParser) accept(ops ...string) (exprToken, bool) {
+	t := p.peek()
+	if t.Kind != "op" {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.Text == op {
+			p.pos++
+			return t, true
+		}
+	}
+	return t, false
+}
+
+// binary parses a sequence of operands separated by the operators, the
+// operands must be of the kind and the result is of the result kind.
+func (p *exprParser) binary(operand func() (*exprNode, error), kind string, result string, ops ...string) (*exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if left.Kind != kind || right.Kind != kind {
+			return nil, exprError("\""+t.Text+"\" requires "+kind+" operands, not "+left.Kind+" and "+right.Kind, t.Pos)
+		}
+
+		left = &exprNode{Op: t.Text, Kind: result, Left: left, Right: right}
+	}
+}
+
+// or parses alternatives separated by ||.
+func (p *exprParser) or() (*exprNode, error) {
+	return p.binary(p.and, "bool", "bool", "||")
+}
+
+// and parses conditions separated by &&.
+func (p *exprParser) and() (*exprNode, error) {
+	return p.binary(p.comparison, "bool", "bool", "&&")
+}
+
+// comparison parses an optional comparison of two sums, strings and
+// booleans may only be tested for equality.
+func (p *exprParser) comparison() (*exprNode, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := p.accept("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left, nil
+	}
+
+	right, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if left.Kind != right.Kind {
+		return nil, exprError("cannot compare "+left.Kind+" with "+right.Kind, t.Pos)
+	}
+	if left.Kind != "number" && t.Text != "==" && t.Text != "!=" {
+		return nil, exprError("\""+t.Text+"\" requires number operands, not "+left.Kind, t.Pos)
+	}
+
+	return &exprNode{Op: t.Text, Kind: "bool", Left: left, Right: right}, nil
+}
+
+// sum parses terms separated by + and -.
+func (p *exprParser) sum() (*exprNode, error) {
+	return p.binary(p.product, "number", "number", "+", "-")
+}
+
+// product parses factors separated by * and /.
+func (p *exprParser) product() (*exprNode, error) {
+	return p.binary(p.unary, "number", "number", "*", "/")
+}
+
+// unary parses a negated or inverted operand.
+func (p *exprParser) unary() (*exprNode, error) {
+	t, ok := p.accept("-", "!")
+	if !ok {
+		return p.primary()
+	}
+
+	n, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	if t.Text == "-" && n.Kind != "number" {
+		return nil, exprError("\"-\" requires a number, not "+n.Kind, t.Pos)
+	}
+	if t.Text == "!" && n.Kind != "bool" {
+		return nil, exprError("\"!\" requires a bool, not "+n.Kind, t.Pos)
+	}
+
+	return &exprNode{Op: t.Text, Kind: n.Kind, Left: n}, nil
+}
+
+// primary parses a literal, field or parenthesized expression.
+func (p *exprParser) primary() (*exprNode, error) {
+	t := p.peek()
+
+	switch t.Kind {
+	case "number":
+		p.pos++
+		v, err := strconv.ParseFloat(t.Text, 64)
+		if err != nil {
+			return nil, exprError("invalid number \""+t.Text+"\"", t.Pos)
+		}
+		return &exprNode{Kind: "number", Value: v}, nil
+	case "string":
+		p.pos++
+		return &exprNode{Kind: "string", Value: t.Text}, nil
+	case "ident":
+		p.pos++
+		if t.Text == "true" || t.Text == "false" {
+			return &exprNode{Kind: "bool", Value: t.Text == "true"}, nil
+		}
+		v, ok := exprField(iexData{}, t.Text)
+		if !ok {
+			return nil, exprError("unknown field \""+t.Text+"\"", t.Pos)
+		}
+		kind := exprKind(v)
+		if kind == "" {
+			return nil, exprError("field \""+t.Text+"\" is not a number, string or bool", t.Pos)
+		}
+		return &exprNode{Kind: kind, Field: t.Text}, nil
+	case "end":
+		return nil, exprError("unexpected end of expression", t.Pos)
+	}
+
+	if _, ok := p.accept("("); ok {
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, exprError("expected \")\"", p.peek().Pos)
+		}
+		return n, nil
+	}
+
+	return nil, exprError("unexpected \""+t.Text+"\"", t.Pos)
+}
+
+// exprField returns the field of the stock data at the path of JSON
+// names, such as quote.latestPrice.
+func exprField(k iexData, path string) (reflect.Value, bool) {
+	v := reflect.ValueOf(k)
+
+	for _, name := range strings.Split(path, ".") {
+		if v.Kind() != reflect.Struct {
+			return v, false
+		}
+
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0] == name {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return v, false
+		}
+	}
+
+	return v, true
+}
+
+// exprKind returns the expression kind of a field, or an empty string
+// when it cannot be used in an expression.
+func exprKind(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	}
+	return ""
+}
+
+// exprValue returns the value of a field as a float64, string or bool.
+func exprValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.String:
+		return v.String()
+	}
+	return v.Bool()
+}
+
+// eval evaluates the node against the stock data.
+func (n *exprNode) eval(k iexData) interface{} {
+	if n.Field != "" {
+		v, _ := exprField(k, n.Field)
+		return exprValue(v)
+	}
+	if n.Op == "" {
+		return n.Value
+	}
+
+	// logical operators evaluate their right operand only when needed
+	switch n.Op {
+	case "!":
+		return !n.Left.eval(k).(bool)
+	case "&&":
+		return n.Left.eval(k).(bool) && n.Right.eval(k).(bool)
+	case "||":
+		return n.Left.eval(k).(bool) || n.Right.eval(k).(bool)
+	case "-":
+		if n.Right == nil {
+			return -n.Left.eval(k).(float64)
+		}
+	}
+
+	left, right := n.Left.eval(k), n.Right.eval(k)
+	switch n.Op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	}
+
+	l, r := left.(float64), right.(float64)
+	switch n.Op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		return l / r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	}
+	return l >= r
+}
+
+// fields returns the sorted paths of the fields the node reads.
+func (n *exprNode) fields() []string {
+	var (
+		paths []string
+		seen  = make(map[string]bool)
+		walk  func(*exprNode)
+	)
+
+	walk = func(n *exprNode) {
+		if n == nil {
+			return
+		}
+		if n.Field != "" && !seen[n.Field] {
+			seen[n.Field] = true
+			paths = append(paths, n.Field)
+		}
+		walk(n.Left)
+		walk(n.Right)
+	}
+	walk(n)
+	sort.Strings(paths)
+
+	return paths
+}
+
+// describe returns the values of the fields the node reads.
+func (n *exprNode) describe(k iexData) string {
+	var values []string
+
+	for _, f := range n.fields() {
+		v, _ := exprField(k, f)
+		switch v := exprValue(v).(type) {
+		case float64:
+			values = append(values, f+"="+strconv.FormatFloat(v, 'f', -1, 64))
+		case string:
+			values = append(values, f+"=\""+v+"\"")
+		case bool:
+			values = append(values, f+"="+strconv.FormatBool(v))
+		}
+	}
+
+	return strings.Join(values, ", ")
+}
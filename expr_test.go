@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// exprStock is the stock data the expression tests are evaluated against.
+var exprStock = iexData{
+	Price: 31,
+	Quote: iexQuote{
+		Symbol:         "AMD",
+		LatestPrice:    31,
+		LatestVolume:   500,
+		AvgTotalVolume: 200,
+	},
+	Stats: iexStats{Day50MovingAvg: 28},
+}
+
+func TestExprEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"price > 30", true},
+		{"price < 30", false},
+		{"price >= 31 && price <= 31", true},
+		{"price == 31", true},
+		{"price != 31", false},
+		{"quote.symbol == 'AMD'", true},
+		{"quote.symbol != \"AMD\"", false},
+		{"!(price > 30)", false},
+		{"price > 100 || quote.symbol == 'AMD'", true},
+		{"price - 1 > 29 && (price - 1) / 2 >= 15", true},
+		{"-price < -30.5", true},
+		{"2 + 3 * 4 == 14", true},
+		{"(2 + 3) * 4 == 20", true},
+		{"quote.latestPrice > stats.day50MovingAvg && quote.latestVolume > 2 * quote.avgTotalVolume", true},
+		{"quote.latestVolume / quote.avgTotalVolume == 2.5", true},
+	}
+
+	for _, tc := range tests {
+		n, err := parseExpr(tc.expr)
+		if err != nil {
+			t.Errorf("parseExpr(%q): %v", tc.expr, err)
+			continue
+		}
+		if got := n.eval(exprStock); got != tc.want {
+			t.Errorf("eval(%q) = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"price >", "position"},
+		{"price + ", "position"},
+		{"(price > 1", "position"},
+		{"price > 1 )", "position"},
+		{"price # 2", "position"},
+		{"'unterminated", "position"},
+		{"quote.nope > 1", "quote.nope"},
+		{"company", "company"},
+		{"price", "comparison"},
+		{"price > 'x'", "string"},
+		{"quote.symbol < 'a'", "string"},
+		{"!price", "bool"},
+		{"price && true", "bool"},
+	}
+
+	for _, tc := range tests {
+		_, err := parseExpr(tc.expr)
+		if err == nil {
+			t.Errorf("parseExpr(%q) succeeded, want an error", tc.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parseExpr(%q) = %q, want it to mention %q", tc.expr, err, tc.want)
+		}
+	}
+}
+
+func TestExprFields(t *testing.T) {
+	n, err := parseExpr("quote.latestPrice > stats.day50MovingAvg && price > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(n.fields(), ",")
+	for _, f := range []string{"quote.latestPrice", "stats.day50MovingAvg", "price"} {
+		if !strings.Contains(got, f) {
+			t.Errorf("fields() = %q, want it to include %q", got, f)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"encoding/json"
+
+	"github.com/TheSp1der/goerror"
+)
+
+// baseCurrency returns the currency values are reported in.
+func baseCurrency() string {
+	if config.BaseCurrency == "" {
+		return "USD"
+	}
+	return strings.ToUpper(config.BaseCurrency)
+}
+
+// currency returns the currency of the account, defaulting to the base
+// currency.
+func (a account) currency() string {
+	if a.Currency == "" {
+		return baseCurrency()
+	}
+	return strings.ToUpper(a.Currency)
+}
+
+// validateCurrencies verifies the cash flows of transactions in a currency
+// other than the account can be converted into the currency of the
+// account, which requires the account to be in the base currency and the
+// transaction to record the exchange rate of the trade.
+func (a account) validateCurrencies(base string) error {
+	base = strings.ToUpper(base)
+	if base == "" {
+		base = "USD"
+	}
+	currency := strings.ToUpper(a.Currency)
+	if currency == "" {
+		currency = base
+	}
+
+	for _, t := range a.Transactions {
+		ccy := strings.ToUpper(t.Currency)
+		if ccy == "" || ccy == currency {
+			continue
+		}
+		if currency != base {
+			return errors.New(t.Type + " on " + t.Date + " is in " + ccy + ", transactions in an account held in " + currency + " must be in " + currency)
+		}
+		if t.FxRate <= 0 {
+			return errors.New(t.Type + " on " + t.Date + " is in " + ccy + " and requires the fxRate of the trade")
+		}
+	}
+
+	return nil
+}
+
+// quoteCurrency returns the currency the stock is quoted in. Currencies
+// set in the configuration file take precedence over the provider.
+func quoteCurrency(k iexData) string {
+	if c, ok := config.Currencies[strings.ToLower(k.Quote.Symbol)]; ok {
+		return strings.ToUpper(c)
+	}
+	if k.Quote.Currency != "" {
+		return strings.ToUpper(k.Quote.Currency)
+	}
+	return "USD"
+}
+
+// update reads the exchange rates from a local file or, when the source
+// is a http(s) address, from a remote provider.
+func (r *exchangeRates) update(source string) error {
+	var (
+		err    error
+		buffer []byte
+		rates  exchangeRates
+	)
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		buffer, err = httpGet(source, httpHeader{})
+	} else {
+		buffer, err = ioutil.ReadFile(source)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(buffer, &rates); err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.Base = strings.ToUpper(rates.Base)
+	r.Rates = make(map[string]float64)
+	for c, v := range rates.Rates {
+		r.Rates[strings.ToUpper(c)] = v
+	}
+	r.Rates[r.Base] = 1
+
+	return nil
+}
+
+// rate returns the number of units of the base currency one unit of the
+// currency is worth, a missing rate is reported once.
+func (r *exchangeRates) rate(currency string) (float64, bool) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == baseCurrency() {
+		return 1, true
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	from, fok := r.Rates[currency]
+	to, tok := r.Rates[baseCurrency()]
+	if !fok || !tok || from == 0 {
+		if r.missing == nil {
+			r.missing = make(map[string]bool)
+		}
+		if !r.missing[currency] {
+			r.missing[currency] = true
+			goerror.Warning(errors.New("no exchange rate from " + currency + " to " + baseCurrency()))
+		}
+		return 0, false
+	}
+
+	return to / from, true
+}
+
+// fxRate returns the current number of units of the base currency one
+// unit of the currency is worth, and false when no rate is available.
+func fxRate(currency string) (float64, bool) {
+	return fxRates.rate(currency)
+}
+
+// foreignCurrency returns a currency of the configuration other than the
+// base currency, or an empty string when every account, transaction and
+// stock uses the base currency.
+func (c configuration) foreignCurrency() string {
+	var currencies []string
+
+	for _, ccy := range c.Currencies {
+		currencies = append(currencies, ccy)
+	}
+	for _, a := range c.Accounts {
+		currencies = append(currencies, a.currency())
+		for _, t := range a.Transactions {
+			currencies = append(currencies, t.Currency)
+		}
+	}
+
+	for _, ccy := range currencies {
+		if ccy != "" && strings.ToUpper(ccy) != baseCurrency() {
+			return strings.ToUpper(ccy)
+		}
+	}
+
+	return ""
+}
+
+// remember records the currency each stock is quoted in.
+func (c *currencyCache) remember(stock iex) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.Symbols == nil {
+		c.Symbols = make(map[string]string)
+	}
+	for _, k := range stock {
+		if k.Quote.Currency != "" {
+			c.Symbols[strings.TrimSpace(strings.ToLower(k.Quote.Symbol))] = strings.ToUpper(k.Quote.Currency)
+		}
+	}
+}
+
+// tickerCurrency returns the currency the ticker is quoted in when no
+// stock data is at hand, from the configuration file or the most recent
+// quote.
+func tickerCurrency(ticker string) string {
+	ticker = strings.TrimSpace(strings.ToLower(ticker))
+	if c, ok := config.Currencies[ticker]; ok {
+		return strings.ToUpper(c)
+	}
+
+	quoteCurrencies.Lock()
+	defer quoteCurrencies.Unlock()
+
+	if c, ok := quoteCurrencies.Symbols[ticker]; ok {
+		return c
+	}
+	return "USD"
+}
+
+// updateExchangeRates refreshes the exchange rates every hour.
+func updateExchangeRates(source string) {
+	for {
+		time.Sleep(time.Duration(time.Hour))
+
+		if err := fxRates.update(source); err != nil {
+			goerror.Warning(err)
+		}
+	}
+}
+
+// lotCurrency returns the currency the lot was purchased in, defaulting
+// to the currency the stock is quoted in.
+func lotCurrency(i investment, k iexData) string {
+	if i.Currency == "" {
+		return quoteCurrency(k)
+	}
+	return i.Currency
+}
+
+// lotGainLoss returns the current base currency value of the lot along
+// with the gain/loss in the currency it was purchased in, the gain/loss
+// in the base currency, and the portion of the base currency gain/loss
+// caused by the change in exchange rate since purchase. It returns false
+// when an exchange rate is missing.
+func lotGainLoss(i investment, k iexData) (float64, float64, float64, float64, bool) {
+	var (
+		now    float64
+		quoted float64
+		bought float64
+		price  float64
+		local  float64
+		base   float64
+		ok     bool
+	)
+
+	if now, ok = fxRate(lotCurrency(i, k)); !ok {
+		return 0, 0, 0, 0, false
+	}
+	if quoted, ok = fxRate(quoteCurrency(k)); !ok {
+		return 0, 0, 0, 0, false
+	}
+	bought = i.FxRate
+	if bought == 0 {
+		bought = now
+	}
+
+	// convert the price to the currency of the lot
+	price = k.Price * quoted / now
+
+	local = i.Quantity * (price - i.Price)
+	base = i.Quantity * (price*now - i.Price*bought)
+
+	return i.Quantity * price * now, local, base, base - local*now, true
+}
+
+// tickerGainLoss returns the base currency value and gain/loss of the
+// lots of the stock, along with the gain/loss of the lots held in each
+// currency other than the base currency. Lots without an exchange rate
+// are left out and reported by returning false.
+func tickerGainLoss(k iexData, lots investments) (float64, float64, []currencyGainLoss, bool) {
+	var (
+		value  float64
+		total  float64
+		byCcy  = make(map[string]currencyGainLoss)
+		result []currencyGainLoss
+		ok     = true
+	)
+
+	for _, i := range lots {
+		if strings.TrimSpace(strings.ToLower(k.Company.Symbol)) != strings.TrimSpace(strings.ToLower(i.Ticker)) {
+			continue
+		}
+
+		cval, local, base, fx, found := lotGainLoss(i, k)
+		if !found {
+			ok = false
+			continue
+		}
+		value = value + cval
+		total = total + base
+
+		ccy := strings.ToUpper(lotCurrency(i, k))
+		if ccy == baseCurrency() {
+			continue
+		}
+		c := byCcy[ccy]
+		c.Currency = ccy
+		c.Local = c.Local + local
+		c.FX = c.FX + fx
+		c.Base = c.Base + base
+		byCcy[ccy] = c
+	}
+
+	for _, c := range byCcy {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Currency < result[j].Currency
+	})
+
+	return value, total, result, ok
+}
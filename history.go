@@ -0,0 +1,454 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/TheSp1der/goerror"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ticksBucket     = []byte("ticks")
+	dailyBucket     = []byte("daily")
+	backfillBucket  = []byte("backfill")
+	valuationBucket = []byte("valuations")
+	alertBucket     = []byte("alerts")
+	reportBucket    = []byte("reports")
+)
+
+// open opens the history database, creating it if it does not exist.
+func (h *priceHistory) open(file string) error {
+	db, err := bolt.Open(file, 0644, &bolt.Options{Timeout: time.Duration(time.Second * 2)})
+	if err != nil {
+		return err
+	}
+
+	h.Lock()
+	h.db = db
+	h.Unlock()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{ticksBucket, dailyBucket, backfillBucket, valuationBucket, alertBucket, reportBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// tickKey returns the database key of a tick recorded at the time, keys
+// sort in time order.
+func tickKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return k
+}
+
+// record stores the snapshot as a tick for every symbol whose quote has
+// been updated, and updates the daily bar of the trading day the quote
+// belongs to.
+func (h *priceHistory) record(stock iex) error {
+	h.Lock()
+	defer h.Unlock()
+
+	var (
+		now    = time.Now()
+		est, _ = time.LoadLocation("America/New_York")
+		ticks  = make(map[string]priceTick)
+	)
+
+	if h.Latest == nil {
+		h.Latest = make(map[string]priceTick)
+	}
+
+	for _, k := range stock {
+		symbol := strings.TrimSpace(strings.ToLower(k.Quote.Symbol))
+		if symbol == "" || k.Price <= 0 {
+			continue
+		}
+
+		tick := priceTick{
+			Time:      now,
+			Price:     k.Price,
+			Open:      k.Quote.Open,
+			High:      k.Quote.High,
+			Low:       k.Quote.Low,
+			Close:     k.Quote.Close,
+			Volume:    k.Quote.LatestVolume,
+			MarketCap: k.Quote.MarketCap,
+			PeRatio:   k.Quote.PeRatio,
+			Update:    k.Quote.LatestUpdate,
+		}
+		prev, seen := h.Latest[symbol]
+		h.Latest[symbol] = tick
+
+		if !seen || prev.Update != tick.Update || prev.Price != tick.Price {
+			ticks[symbol] = tick
+		}
+	}
+
+	if h.db == nil || len(ticks) == 0 {
+		return nil
+	}
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		for symbol, tick := range ticks {
+			var (
+				bar  priceBar
+				date = now.In(est).Format(dateFormat)
+			)
+
+			// the trading day is taken from the quote so prices
+			// recorded while the market is closed update the last
+			// trading day
+			if tick.Update > 0 {
+				date = time.Unix(0, tick.Update*int64(time.Millisecond)).In(est).Format(dateFormat)
+			}
+
+			t, err := tx.Bucket(ticksBucket).CreateBucketIfNotExists([]byte(symbol))
+			if err != nil {
+				return err
+			}
+			buffer, _ := json.Marshal(tick)
+			if err = t.Put(tickKey(tick.Time), buffer); err != nil {
+				return err
+			}
+
+			d, err := tx.Bucket(dailyBucket).CreateBucketIfNotExists([]byte(symbol))
+			if err != nil {
+				return err
+			}
+			if v := d.Get([]byte(date)); v != nil {
+				json.Unmarshal(v, &bar)
+			} else {
+				bar = priceBar{Date: date, Open: tick.Price, High: tick.Price, Low: tick.Price}
+			}
+
+			if tick.Open > 0 {
+				bar.Open = tick.Open
+			}
+			bar.High = math.Max(bar.High, math.Max(tick.Price, tick.High))
+			bar.Low = math.Min(bar.Low, tick.Price)
+			if tick.Low > 0 {
+				bar.Low = math.Min(bar.Low, tick.Low)
+			}
+			bar.Close = tick.Price
+			if tick.Volume > bar.Volume {
+				bar.Volume = tick.Volume
+			}
+			bar.MarketCap = tick.MarketCap
+			bar.PeRatio = tick.PeRatio
+
+			buffer, _ = json.Marshal(bar)
+			if err = d.Put([]byte(date), buffer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// close returns the most recent closing price of the symbol on or
+// before the date, the latest tick is used for the current day.
+func (h *priceHistory) close(symbol string, date time.Time) (float64, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	var (
+		price float64
+		found bool
+		d     = date.Format(dateFormat)
+	)
+
+	symbol = strings.ToLower(symbol)
+	if t, ok := h.Latest[symbol]; ok && !date.Before(startOfDay(t.Time)) {
+		return t.Price, true
+	}
+
+	if h.db == nil {
+		return 0, false
+	}
+
+	h.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(dailyBucket).Bucket([]byte(symbol))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		k, v := c.Seek([]byte(d))
+		if k == nil {
+			k, v = c.Last()
+		} else if string(k) > d {
+			k, v = c.Prev()
+		}
+		if k == nil {
+			return nil
+		}
+
+		var bar priceBar
+		if err := json.Unmarshal(v, &bar); err == nil {
+			price = bar.Close
+			found = true
+		}
+		return nil
+	})
+
+	return price, found
+}
+
+// bars returns the daily bars of the symbol between the dates inclusive.
+func (h *priceHistory) bars(symbol string, from time.Time, to time.Time) ([]priceBar, error) {
+	var bars []priceBar
+
+	if h.db == nil {
+		return bars, nil
+	}
+
+	err := h.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(dailyBucket).Bucket([]byte(strings.ToLower(symbol)))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		end := to.Format(dateFormat)
+		for k, v := c.Seek([]byte(from.Format(dateFormat))); k != nil && string(k) <= end; k, v = c.Next() {
+			var bar priceBar
+			if err := json.Unmarshal(v, &bar); err != nil {
+				return err
+			}
+			bars = append(bars, bar)
+		}
+		return nil
+	})
+
+	return bars, err
+}
+
+// putBars stores daily bars of the symbol, replacing the prices and volume
+// of any bars already recorded for the same dates while keeping the market
+// capitalization and P/E ratio they recorded when the bar carries none.
+func (h *priceHistory) putBars(symbol string, bars []priceBar) error {
+	if h.db == nil {
+		return nil
+	}
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		d, err := tx.Bucket(dailyBucket).CreateBucketIfNotExists([]byte(strings.ToLower(symbol)))
+		if err != nil {
+			return err
+		}
+
+		for _, bar := range bars {
+			var recorded priceBar
+			if v := d.Get([]byte(bar.Date)); v != nil && json.Unmarshal(v, &recorded) == nil {
+				if bar.MarketCap == 0 {
+					bar.MarketCap = recorded.MarketCap
+				}
+				if bar.PeRatio == 0 {
+					bar.PeRatio = recorded.PeRatio
+				}
+			}
+
+			buffer, _ := json.Marshal(bar)
+			if err = d.Put([]byte(bar.Date), buffer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// backfilled returns the date of the most recent daily bar of the symbol
+// received from the provider, or an empty string if it has never been
+// backfilled.
+func (h *priceHistory) backfilled(symbol string) string {
+	var date string
+
+	if h.db == nil {
+		return date
+	}
+
+	h.db.View(func(tx *bolt.Tx) error {
+		date = string(tx.Bucket(backfillBucket).Get([]byte(strings.ToLower(symbol))))
+		return nil
+	})
+
+	return date
+}
+
+// setBackfilled records the date of the most recent daily bar of the
+// symbol received from the provider.
+func (h *priceHistory) setBackfilled(symbol string, date string) error {
+	if h.db == nil {
+		return nil
+	}
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(backfillBucket).Put([]byte(strings.ToLower(symbol)), []byte(date))
+	})
+}
+
+// alertStates returns the stored state of every alert rule.
+func (h *priceHistory) alertStates() map[string]alertState {
+	var states = make(map[string]alertState)
+
+	if h.db == nil {
+		return states
+	}
+
+	h.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(alertBucket).ForEach(func(k []byte, v []byte) error {
+			var st alertState
+			if err := json.Unmarshal(v, &st); err == nil {
+				states[string(k)] = st
+			}
+			return nil
+		})
+	})
+
+	return states
+}
+
+// putAlertState stores the state of an alert rule so it survives a
+// restart.
+func (h *priceHistory) putAlertState(name string, st alertState) error {
+	if h.db == nil {
+		return nil
+	}
+
+	buffer, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(alertBucket).Put([]byte(name), buffer)
+	})
+}
+
+// lastReport returns the time the report was last scheduled to run.
+func (h *priceHistory) lastReport(name string) time.Time {
+	var last time.Time
+
+	if h.db == nil {
+		return last
+	}
+
+	h.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(reportBucket).Get([]byte(name)); v != nil {
+			last, _ = time.Parse(time.RFC3339, string(v))
+		}
+		return nil
+	})
+
+	return last
+}
+
+// putReport records the time the report was scheduled to run.
+func (h *priceHistory) putReport(name string, t time.Time) error {
+	if h.db == nil {
+		return nil
+	}
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(reportBucket).Put([]byte(name), []byte(t.Format(time.RFC3339)))
+	})
+}
+
+// ticks returns the intraday ticks of the symbol between the times.
+func (h *priceHistory) ticks(symbol string, from time.Time, to time.Time) ([]priceTick, error) {
+	var ticks []priceTick
+
+	if h.db == nil {
+		return ticks, nil
+	}
+
+	err := h.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(ticksBucket).Bucket([]byte(strings.ToLower(symbol)))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		end := tickKey(to)
+		for k, v := c.Seek(tickKey(from)); k != nil && string(k) <= string(end); k, v = c.Next() {
+			var tick priceTick
+			if err := json.Unmarshal(v, &tick); err != nil {
+				return err
+			}
+			ticks = append(ticks, tick)
+		}
+		return nil
+	})
+
+	return ticks, err
+}
+
+// prune removes ticks older than the retention period and downsamples
+// ticks older than a day to the last tick of each interval.
+func (h *priceHistory) prune(retention time.Duration, interval time.Duration) error {
+	if h.db == nil {
+		return nil
+	}
+
+	var (
+		expire = tickKey(time.Now().Add(-retention))
+		sample = tickKey(time.Now().Add(-time.Duration(time.Hour * 24)))
+	)
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(ticksBucket).ForEach(func(symbol []byte, _ []byte) error {
+			var (
+				b       = tx.Bucket(ticksBucket).Bucket(symbol)
+				remove  [][]byte
+				prevKey []byte
+				prevWin int64 = -1
+			)
+
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil && string(k) < string(sample); k, _ = c.Next() {
+				key := append([]byte{}, k...)
+				if string(k) < string(expire) {
+					remove = append(remove, key)
+					continue
+				}
+
+				if interval <= 0 {
+					continue
+				}
+				win := int64(binary.BigEndian.Uint64(k)) / int64(interval)
+				if win == prevWin {
+					remove = append(remove, prevKey)
+				}
+				prevKey = key
+				prevWin = win
+			}
+
+			for _, k := range remove {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// maintainHistory prunes the history database every hour.
+func maintainHistory(retention time.Duration, interval time.Duration) {
+	for {
+		if err := history.prune(retention, interval); err != nil {
+			goerror.Warning(err)
+		}
+
+		time.Sleep(time.Duration(time.Hour))
+	}
+}
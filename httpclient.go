@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"io/ioutil"
 	"net"
@@ -62,3 +63,57 @@ func httpGet(url string, headers httpHeader) ([]byte, error) {
 
 	return output, nil
 }
+
+// httpSend sends the body to a remote webserver with the method (POST or
+// PUT), returning the response body and status code.
+func httpSend(method string, url string, headers httpHeader, contentType string, body []byte) ([]byte, int, error) {
+	var (
+		err    error          // error handler
+		client http.Client    // http client
+		req    *http.Request  // http request
+		res    *http.Response // http response
+		output []byte         // output
+	)
+
+	// set timeouts
+	client = http.Client{
+		Timeout: time.Duration(time.Second * 10),
+		Transport: &http.Transport{
+			Dial: (&net.Dialer{
+				Timeout: time.Duration(time.Second * 5),
+			}).Dial,
+			TLSHandshakeTimeout: time.Duration(time.Second * 5),
+		},
+	}
+
+	// setup request
+	if req, err = http.NewRequest(method, url, bytes.NewReader(body)); err != nil {
+		return output, 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	// setup headers
+	for _, header := range headers {
+		req.Header.Set(header.Name, header.Value)
+	}
+
+	// perform the request
+	if res, err = client.Do(req); err != nil {
+		return output, 0, err
+	}
+
+	// close the connection upon function closure
+	defer res.Body.Close()
+
+	// extract response body
+	if output, err = ioutil.ReadAll(res.Body); err != nil {
+		return output, res.StatusCode, err
+	}
+
+	// check status
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return output, res.StatusCode, errors.New("non-successful status code received [" + strconv.Itoa(res.StatusCode) + "]")
+	}
+
+	return output, res.StatusCode, nil
+}
@@ -35,6 +35,7 @@ func webListener(s <-chan iex, port int) {
 	ws.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		webRoot(w, r, s)
 	})
+	ws.HandleFunc("/export", webExport)
 
 	if err := srv.ListenAndServe(); err != nil {
 		goerror.Fatal(err)
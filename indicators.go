@@ -0,0 +1,182 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dailyCloses returns the closing prices of the symbol for up to the
+// number of trading days before today from the history database,
+// followed by the current price.
+func dailyCloses(symbol string, days int, price float64) []float64 {
+	var (
+		closes []float64
+		est, _ = time.LoadLocation("America/New_York")
+		today  = time.Now().In(est).Format(dateFormat)
+	)
+
+	// allow for weekends and holidays when selecting calendar days
+	bars, _ := history.bars(symbol, time.Now().AddDate(0, 0, -(days*7/5+10)), time.Now())
+	for _, b := range bars {
+		if b.Date < today && b.Close > 0 {
+			closes = append(closes, b.Close)
+		}
+	}
+	if len(closes) > days {
+		closes = closes[len(closes)-days:]
+	}
+
+	return append(closes, price)
+}
+
+// movingAverage returns the simple moving average of the last period
+// values, or zero when there are not enough values.
+func movingAverage(values []float64, period int) float64 {
+	var total float64
+
+	if period <= 0 || len(values) < period {
+		return 0
+	}
+
+	for _, v := range values[len(values)-period:] {
+		total = total + v
+	}
+
+	return total / float64(period)
+}
+
+// relativeStrength returns the relative strength index of the values over
+// the period using Wilder's smoothing, or a negative value when there are
+// not enough values.
+func relativeStrength(values []float64, period int) float64 {
+	var gain, loss float64
+
+	if period <= 0 || len(values) <= period {
+		return -1
+	}
+
+	for i := 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		up, down := math.Max(change, 0), math.Max(-change, 0)
+
+		if i <= period {
+			gain = gain + up/float64(period)
+			loss = loss + down/float64(period)
+			continue
+		}
+		gain = (gain*float64(period-1) + up) / float64(period)
+		loss = (loss*float64(period-1) + down) / float64(period)
+	}
+
+	if loss == 0 {
+		return 100
+	}
+
+	return 100 - 100/(1+gain/loss)
+}
+
+// bollingerBands returns the lower and upper bands the deviations of the
+// standard deviation around the moving average of the last period values.
+func bollingerBands(values []float64, period int, deviations float64) (float64, float64, bool) {
+	var variance float64
+
+	mean := movingAverage(values, period)
+	if mean == 0 {
+		return 0, 0, false
+	}
+
+	for _, v := range values[len(values)-period:] {
+		variance = variance + (v-mean)*(v-mean)
+	}
+	sd := math.Sqrt(variance / float64(period))
+
+	return mean - deviations*sd, mean + deviations*sd, true
+}
+
+// period returns the period of the rule or the default when not set.
+func (r alertRule) period(def int) int {
+	if r.Period > 0 {
+		return r.Period
+	}
+	return def
+}
+
+// threshold returns the value of the rule or the default when not set.
+func (r alertRule) threshold(def float64) float64 {
+	if r.Value != 0 {
+		return r.Value
+	}
+	return def
+}
+
+// indicator returns whether a technical indicator rule is true for the
+// stock data along with a description of the indicator. Values supplied
+// by the provider are used when available, otherwise they are calculated
+// from the daily closes recorded in the history database.
+func (r alertRule) indicator(k iexData) (bool, string) {
+	var (
+		symbol = strings.ToUpper(r.Ticker)
+		price  = strconv.FormatFloat(k.Price, 'f', 2, 64)
+		format = func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	)
+
+	switch r.Type {
+	case "goldencross", "deathcross":
+		// a crossing is a change from the averages of the previous close
+		closes := dailyCloses(r.Ticker, 200, k.Price)
+		prevShort, prevLong := movingAverage(closes[:len(closes)-1], 50), movingAverage(closes[:len(closes)-1], 200)
+		short, long := k.Stats.Day50MovingAvg, k.Stats.Day200MovingAvg
+		if short == 0 || long == 0 {
+			short, long = movingAverage(closes, 50), movingAverage(closes, 200)
+		}
+		if short == 0 || long == 0 || prevShort == 0 || prevLong == 0 {
+			return false, ""
+		}
+		if r.Type == "goldencross" {
+			return prevShort <= prevLong && short > long, symbol + " 50 day average " + format(short) + " crossed above the 200 day average " + format(long)
+		}
+		return prevShort >= prevLong && short < long, symbol + " 50 day average " + format(short) + " crossed below the 200 day average " + format(long)
+
+	case "high52", "low52":
+		high, low := k.Quote.Week52High, k.Quote.Week52Low
+		if high == 0 || low == 0 {
+			closes := dailyCloses(r.Ticker, 252, k.Price)
+			closes = closes[:len(closes)-1]
+			if len(closes) == 0 {
+				return false, ""
+			}
+			high, low = closes[0], closes[0]
+			for _, c := range closes {
+				high, low = math.Max(high, c), math.Min(low, c)
+			}
+		}
+		if r.Type == "high52" {
+			return k.Price >= high, symbol + " price " + price + " is a new 52 week high, previously " + format(high)
+		}
+		return k.Price <= low, symbol + " price " + price + " is a new 52 week low, previously " + format(low)
+
+	case "overbought", "oversold":
+		period := r.period(14)
+		rsi := relativeStrength(dailyCloses(r.Ticker, period*10, k.Price), period)
+		if rsi < 0 {
+			return false, ""
+		}
+		message := symbol + " " + strconv.Itoa(period) + " day RSI " + format(rsi)
+		if r.Type == "overbought" {
+			return rsi >= r.threshold(70), message + " is overbought"
+		}
+		return rsi <= r.threshold(30), message + " is oversold"
+
+	case "bollinger":
+		period := r.period(20)
+		lower, upper, ok := bollingerBands(dailyCloses(r.Ticker, period-1, k.Price), period, r.threshold(2))
+		if !ok {
+			return false, ""
+		}
+		return k.Price > upper || k.Price < lower, symbol + " price " + price + " is outside the Bollinger bands " + format(lower) + " - " + format(upper)
+	}
+
+	return false, ""
+}
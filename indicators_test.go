@@ -0,0 +1,76 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// indicatorHistory opens a history database holding the daily closes of
+// the symbol on the weekdays before today, oldest first.
+func indicatorHistory(t *testing.T, symbol string, closes []float64) {
+	var bars []priceBar
+
+	if err := history.open(filepath.Join(t.TempDir(), "history.db")); err != nil {
+		t.Fatal(err)
+	}
+
+	d := time.Now()
+	for i := len(closes) - 1; i >= 0; {
+		d = d.AddDate(0, 0, -1)
+		if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+			continue
+		}
+		bars = append(bars, priceBar{Date: d.Format(dateFormat), Close: closes[i]})
+		i--
+	}
+
+	if err := history.putBars(symbol, bars); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMovingAverageCross(t *testing.T) {
+	var flat, rising []float64
+
+	// a flat 200 days, and one where the last 50 days closed higher
+	for i := 0; i < 200; i++ {
+		flat = append(flat, 100)
+		rising = append(rising, 100)
+		if i >= 150 {
+			rising[i] = 110
+		}
+	}
+
+	tests := []struct {
+		name   string
+		closes []float64
+		price  float64
+		golden bool
+		death  bool
+	}{
+		{"rises above", flat, 110, true, false},
+		{"falls below", flat, 90, false, true},
+		{"unchanged", flat, 100, false, false},
+		{"already above", rising, 110, false, false},
+		{"not enough closes", flat[:120], 110, false, false},
+	}
+
+	defer func() { history.db = nil }()
+
+	for _, tc := range tests {
+		indicatorHistory(t, "abc", tc.closes)
+
+		k := iexData{Price: tc.price}
+		k.Company.Symbol = "ABC"
+
+		if got, _ := (alertRule{Type: "goldencross", Ticker: "abc"}).indicator(k); got != tc.golden {
+			t.Errorf("%s: golden cross = %v, want %v", tc.name, got, tc.golden)
+		}
+		if got, _ := (alertRule{Type: "deathcross", Ticker: "abc"}).indicator(k); got != tc.death {
+			t.Errorf("%s: death cross = %v, want %v", tc.name, got, tc.death)
+		}
+
+		history.db.Close()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"regexp"
 	"strconv"
@@ -14,18 +15,42 @@ import (
 
 // global variables
 var (
-	cmdLnStocks       string
-	cmdLnInvestments  investments
-	cmdLnEmailAddress string
-	cmdLnEmailHost    string
-	cmdLnEmailPort    int
-	cmdLnEmailFrom    string
-	cmdLnNoConsole    bool
-	cmdLnHTTPPort     int
+	cmdLnStocks        string
+	cmdLnInvestments   investments
+	cmdLnEmailTo       []string
+	cmdLnEmailCc       []string
+	cmdLnEmailBcc      []string
+	cmdLnEmailAttach   []string
+	cmdLnEmailHost     string
+	cmdLnEmailPort     int
+	cmdLnEmailFrom     string
+	cmdLnEmailUser     string
+	cmdLnEmailPassword string
+	cmdLnEmailAuth     string
+	cmdLnEmailTLS      string
+	cmdLnEmailInsecure bool
+	cmdLnEmailCA       string
+	cmdLnEmailQueue    string
+	cmdLnEmailExpiry   int
+	cmdLnNoConsole     bool
+	cmdLnHTTPPort      int
+	cmdLnConfigFile    string
+	cmdLnHistoryFile   string
+	cmdLnRetention     int
+	cmdLnDownsample    int
+	cmdLnFxRates       string
 
-	trackedTickers []string
+	config          configuration
+	history         priceHistory
+	fxRates         exchangeRates
+	quoteCurrencies currencyCache
+	alerts          alertEngine
+	volumeProfile   volumeCache
+	positions       investments
+	trackedTickers  []string
 
 	timeFormat = "2006-01-02 15:04:05"
+	dateFormat = "2006-01-02"
 )
 
 // getEnvString returns string from environment variable.
@@ -105,36 +130,142 @@ func (i *investments) Set(value string) error {
 	return nil
 }
 
-// init configures the parameters the process needs to run.
-func init() {
+// setup configures the parameters the process needs to run, it is called
+// from main rather than init so tests can run without the command line.
+func setup() {
 	// read command line options
 	flag.Var(&cmdLnInvestments, "invest", "Formatted investment in the form of \"Ticker,Quantity,Price\".")
 	stocks := flag.String("ticker", getEnvString("TICKERS", ""), "(TICKERS)\nComma saperated list of stocks to report.")
-	mailAddress := flag.String("mailto", getEnvString("EMAIL_TO", ""), "(EMAIL_TO)\nDestination e-mail address that will receive the end of day summary.")
+	mailAddress := flag.String("mailto", getEnvString("EMAIL_TO", ""), "(EMAIL_TO)\nComma separated list of e-mail addresses that will receive the end of day summary.")
+	mailCc := flag.String("mailcc", getEnvString("EMAIL_CC", ""), "(EMAIL_CC)\nComma separated list of e-mail addresses copied on the end of day summary.")
+	mailBcc := flag.String("mailbcc", getEnvString("EMAIL_BCC", ""), "(EMAIL_BCC)\nComma separated list of e-mail addresses blind copied on the end of day summary.")
+	mailAttach := flag.String("mailattach", getEnvString("EMAIL_ATTACH", ""), "(EMAIL_ATTACH)\nComma separated list of attachments added to the end of day summary: csv, pdf.")
 	mailHost := flag.String("mailhost", getEnvString("EMAIL_HOST", ""), "(EMAIL_HOST)\nE-Mail server host.")
 	mailPort := flag.Int("mailport", getEnvInt("EMAIL_PORT", 25), "(EMAIL_PORT)\nE-Mail server port.")
 	mailFrom := flag.String("mailfrom", getEnvString("EMAIL_FROM", "noreply@localhost"), "(EMAIL_FROM)\nAddress the message will be sent from.")
+	mailUser := flag.String("mailuser", getEnvString("EMAIL_USER", ""), "(EMAIL_USER)\nUser to authenticate to the e-mail server as.")
+	mailPassword := flag.String("mailpassword", getEnvString("EMAIL_PASSWORD", ""), "(EMAIL_PASSWORD)\nPassword to authenticate to the e-mail server with.")
+	mailPasswordFile := flag.String("mailpasswordfile", getEnvString("EMAIL_PASSWORD_FILE", ""), "(EMAIL_PASSWORD_FILE)\nFile containing the password to authenticate to the e-mail server with.")
+	mailAuth := flag.String("mailauth", getEnvString("EMAIL_AUTH", ""), "(EMAIL_AUTH)\nE-Mail authentication mechanism: plain, login or cram-md5.")
+	mailTLS := flag.String("mailtls", getEnvString("EMAIL_TLS", ""), "(EMAIL_TLS)\nE-Mail connection security: none, starttls, require or tls.")
+	mailInsecure := flag.Bool("mailinsecure", getEnvBool("EMAIL_INSECURE", false), "(EMAIL_INSECURE)\nDon't verify the e-mail server certificate.")
+	mailCA := flag.String("mailca", getEnvString("EMAIL_CA", ""), "(EMAIL_CA)\nCertificate authority file the e-mail server certificate is verified with.")
+	mailQueue := flag.String("mailqueue", getEnvString("EMAIL_QUEUE", ""), "(EMAIL_QUEUE)\nDirectory outgoing e-mail is queued in until it is delivered.")
+	mailExpiry := flag.Int("mailexpiry", getEnvInt("EMAIL_QUEUE_EXPIRY", 48), "(EMAIL_QUEUE_EXPIRY)\nHours queued e-mail is retried for before it is discarded.")
 	noConsole := flag.Bool("noconsole", getEnvBool("NO_CONSOLE", false), "(NO_CONSOLE)\nDon't display stock data in the console.")
 	webPort := flag.Int("webport", getEnvInt("WEB_PORT", 0), "(WEB_PORT)\nWeb server listen port.")
+	configFile := flag.String("config", getEnvString("CONFIG_FILE", ""), "(CONFIG_FILE)\nConfiguration file containing accounts and transactions.")
+	historyFile := flag.String("history", getEnvString("HISTORY_FILE", ""), "(HISTORY_FILE)\nDatabase file price history is recorded in.")
+	retention := flag.Int("retention", getEnvInt("HISTORY_RETENTION", 30), "(HISTORY_RETENTION)\nDays intraday prices are kept in the history database.")
+	downsample := flag.Int("downsample", getEnvInt("HISTORY_DOWNSAMPLE", 5), "(HISTORY_DOWNSAMPLE)\nMinutes intraday prices older than a day are downsampled to.")
+	rates := flag.String("fxrates", getEnvString("FX_RATES", ""), "(FX_RATES)\nFile or http(s) address providing exchange rates.")
 	flag.Parse()
 
 	// set global variables
 	cmdLnStocks = strings.ToLower(*stocks)
-	cmdLnEmailAddress = *mailAddress
+	cmdLnEmailTo = splitAddresses(*mailAddress)
+	cmdLnEmailCc = splitAddresses(*mailCc)
+	cmdLnEmailBcc = splitAddresses(*mailBcc)
+	if *mailAttach != "" {
+		cmdLnEmailAttach = strings.Split(strings.ToLower(strings.Replace(*mailAttach, " ", "", -1)), ",")
+	}
 	cmdLnEmailHost = *mailHost
 	cmdLnEmailPort = *mailPort
 	cmdLnEmailFrom = *mailFrom
+	cmdLnEmailUser = *mailUser
+	cmdLnEmailPassword = *mailPassword
+	cmdLnEmailAuth = strings.ToLower(*mailAuth)
+	cmdLnEmailTLS = strings.ToLower(*mailTLS)
+	cmdLnEmailInsecure = *mailInsecure
+	cmdLnEmailCA = *mailCA
+	cmdLnEmailQueue = *mailQueue
+	cmdLnEmailExpiry = *mailExpiry
 	cmdLnNoConsole = *noConsole
 	cmdLnHTTPPort = *webPort
+	cmdLnConfigFile = *configFile
+	cmdLnHistoryFile = *historyFile
+	cmdLnRetention = *retention
+	cmdLnDownsample = *downsample
+	cmdLnFxRates = *rates
+
+	// read the e-mail password from the secret file
+	if *mailPasswordFile != "" {
+		buffer, err := ioutil.ReadFile(*mailPasswordFile)
+		if err != nil {
+			goerror.Fatal(err)
+		}
+		cmdLnEmailPassword = strings.TrimRight(string(buffer), "\r\n")
+	}
+
+	// verify the e-mail security options
+	switch cmdLnEmailAuth {
+	case "", "plain", "login", "cram-md5":
+	default:
+		goerror.Fatal(errors.New("unknown e-mail authentication mechanism \"" + cmdLnEmailAuth + "\""))
+	}
+	switch cmdLnEmailTLS {
+	case "", "none", "starttls", "require", "tls":
+	default:
+		goerror.Fatal(errors.New("unknown e-mail connection security \"" + cmdLnEmailTLS + "\""))
+	}
+	if err := validAttachments(cmdLnEmailAttach); err != nil {
+		goerror.Fatal(err)
+	}
+
+	// create the mail queue directory
+	if cmdLnEmailQueue != "" {
+		if err := os.MkdirAll(cmdLnEmailQueue, 0700); err != nil {
+			goerror.Fatal(err)
+		}
+	}
+
+	// read the configuration file
+	if cmdLnConfigFile != "" {
+		var err error
+		if config, err = loadConfig(cmdLnConfigFile); err != nil {
+			goerror.Fatal(err)
+		}
+	}
+
+	// open the price history database
+	if cmdLnHistoryFile != "" {
+		if err := history.open(cmdLnHistoryFile); err != nil {
+			goerror.Fatal(err)
+		}
+	}
+
+	// scheduled reports record their runs in the history database so a
+	// restart does not send them again
+	if len(config.Reports) > 0 && cmdLnHistoryFile == "" && flag.NArg() == 0 && (mailEnabled() || len(config.Notifiers) > 0) {
+		goerror.Fatal(errors.New("-history is required to schedule reports"))
+	}
+
+	// exchange rates are required to convert other currencies
+	if ccy := config.foreignCurrency(); ccy != "" && cmdLnFxRates == "" {
+		goerror.Fatal(errors.New("-fxrates is required to convert " + ccy + " to " + baseCurrency()))
+	}
+
+	// read exchange rates
+	if cmdLnFxRates != "" {
+		if err := fxRates.update(cmdLnFxRates); err != nil {
+			goerror.Warning(err)
+		}
+	}
+
+	// combine investments provided on the command line with the open
+	// lots of each account
+	for _, i := range cmdLnInvestments {
+		i.Account = "default"
+		positions = append(positions, i)
+	}
+	lots, _, _ := matchAccounts(config.Accounts)
+	positions = append(positions, lots...)
 
 	// convert input to struct
-	re := regexp.MustCompile(`(\s+)?,(\s+)?`)
-	trackedTickers = re.Split(cmdLnStocks, -1)
+	if cmdLnStocks != "" {
+		re := regexp.MustCompile(`(\s+)?,(\s+)?`)
+		trackedTickers = re.Split(cmdLnStocks, -1)
 
-	// verify stocks were provided
-	if len(trackedTickers) == 1 && trackedTickers[0] == "" {
-		goerror.Fatal(errors.New("no Stocks defined"))
-	} else {
 		re = regexp.MustCompile(`^[a-z0-9]+$`)
 		for _, value := range trackedTickers {
 			if !re.Match([]byte(value)) {
@@ -144,9 +275,33 @@ func init() {
 	}
 
 	// add stocks from investments
-	if len(cmdLnInvestments) > 0 {
-		for _, i := range cmdLnInvestments {
-			trackedTickers = append(trackedTickers, strings.ToLower(i.Ticker))
+	for _, i := range positions {
+		trackedTickers = append(trackedTickers, strings.ToLower(i.Ticker))
+	}
+
+	// add stocks from the target allocation
+	for _, c := range config.Allocation.Classes {
+		for t := range c.Tickers {
+			trackedTickers = append(trackedTickers, strings.TrimSpace(strings.ToLower(t)))
 		}
 	}
+
+	// add stocks the alert rules are checked against
+	for _, r := range config.Alerts {
+		if r.Ticker != "" {
+			trackedTickers = append(trackedTickers, strings.TrimSpace(strings.ToLower(r.Ticker)))
+		}
+	}
+
+	// add stocks on the watchlists of the recipients
+	for _, r := range config.Recipients {
+		for _, t := range r.Tickers {
+			trackedTickers = append(trackedTickers, strings.TrimSpace(strings.ToLower(t)))
+		}
+	}
+
+	// verify stocks were provided
+	if len(trackedTickers) == 0 {
+		goerror.Fatal(errors.New("no Stocks defined"))
+	}
 }
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"encoding/json"
+)
+
+// loadConfig reads and validates the configuration file.
+func loadConfig(file string) (configuration, error) {
+	var (
+		err    error
+		c      configuration
+		buffer []byte
+	)
+
+	if buffer, err = ioutil.ReadFile(file); err != nil {
+		return c, err
+	}
+
+	if err = json.Unmarshal(buffer, &c); err != nil {
+		return c, err
+	}
+
+	names := make(map[string]bool)
+	for _, a := range c.Accounts {
+		if a.Name == "" {
+			return c, errors.New("account name is required")
+		}
+		if names[a.Name] {
+			return c, errors.New("account " + a.Name + " is defined more than once")
+		}
+		names[a.Name] = true
+		if _, err = a.lots(); err != nil {
+			return c, errors.New("account " + a.Name + ": " + err.Error())
+		}
+		if err = a.validateCurrencies(c.BaseCurrency); err != nil {
+			return c, errors.New("account " + a.Name + ": " + err.Error())
+		}
+	}
+
+	if err = c.Allocation.validate(); err != nil {
+		return c, err
+	}
+
+	if err = c.validateAlerts(); err != nil {
+		return c, err
+	}
+
+	if err = c.validateNotifiers(); err != nil {
+		return c, err
+	}
+
+	if err = c.validateReports(); err != nil {
+		return c, err
+	}
+
+	if err = c.validateRecipients(); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// time returns the date the transaction took place.
+func (t transaction) time() (time.Time, error) {
+	return time.ParseInLocation(dateFormat, t.Date, time.Local)
+}
+
+// validate verifies the transaction contains the fields required
+// by its type.
+func (t transaction) validate() error {
+	if _, err := t.time(); err != nil {
+		return errors.New("transaction date \"" + t.Date + "\" is not in the form YYYY-MM-DD")
+	}
+
+	switch t.Type {
+	case "deposit", "withdrawal", "interest", "dividend", "fee":
+		if t.Amount <= 0 {
+			return errors.New(t.Type + " on " + t.Date + " requires a positive amount")
+		}
+	case "buy", "sell":
+		if t.Ticker == "" || t.Quantity <= 0 || t.Price <= 0 {
+			return errors.New(t.Type + " on " + t.Date + " requires a ticker, quantity and price")
+		}
+	default:
+		return errors.New("unknown transaction type \"" + t.Type + "\"")
+	}
+
+	return nil
+}
+
+// cashFlow returns the change in the account cash balance caused by
+// the transaction.
+func (t transaction) cashFlow() float64 {
+	switch t.Type {
+	case "deposit", "interest", "dividend":
+		return t.Amount
+	case "withdrawal", "fee":
+		return -t.Amount
+	case "buy":
+		return -(t.Quantity*t.Price + t.Fee)
+	case "sell":
+		return t.Quantity*t.Price - t.Fee
+	}
+	return 0
+}
+
+// cashFlow returns the change in the account cash balance caused by the
+// transaction in the currency of the account, transactions in another
+// currency are converted with the exchange rate they record.
+func (a account) cashFlow(t transaction) float64 {
+	if ccy := strings.ToUpper(t.Currency); ccy != "" && ccy != a.currency() {
+		return t.cashFlow() * t.FxRate
+	}
+	return t.cashFlow()
+}
+
+// ledger returns the account transactions ordered by date.
+func (a account) ledger() []transaction {
+	l := make([]transaction, len(a.Transactions))
+	copy(l, a.Transactions)
+
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Date < l[j].Date
+	})
+
+	return l
+}
+
+// cash returns the cash balance of the account.
+func (a account) cash() float64 {
+	var c float64
+
+	for _, t := range a.Transactions {
+		c = c + a.cashFlow(t)
+	}
+
+	return c
+}
+
+// contributions returns the net amount deposited into the account.
+func (a account) contributions() float64 {
+	var c float64
+
+	for _, t := range a.Transactions {
+		switch t.Type {
+		case "deposit", "withdrawal":
+			c = c + a.cashFlow(t)
+		}
+	}
+
+	return c
+}
+
+// lots returns the open lots of the account on its own, sales are matched
+// against the oldest purchases of the same ticker first.
+func (a account) lots() (investments, error) {
+	open, _, err := matchAccounts([]account{a})
+	return open, err
+}
+
+// combinedLedger returns the transactions of all of the accounts ordered
+// by date along with the account each belongs to.
+func combinedLedger(accounts []account) ([]transaction, []account) {
+	var (
+		ledger []transaction
+		owners []account
+		order  []int
+	)
+
+	for _, a := range accounts {
+		for _, t := range a.Transactions {
+			ledger = append(ledger, t)
+			owners = append(owners, a)
+			order = append(order, len(order))
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return ledger[order[i]].Date < ledger[order[j]].Date
+	})
+
+	l := make([]transaction, len(order))
+	o := make([]account, len(order))
+	for n, i := range order {
+		l[n], o[n] = ledger[i], owners[i]
+	}
+
+	return l, o
+}
+
+// matchAccounts replays the ledgers of the accounts together matching each
+// sale against the oldest purchases of the same ticker in its account, and
+// returns the lots still open along with the realized gain/loss of every
+// lot sold. Losses are checked for wash sales as they are realized against
+// purchases in any of the accounts.
+func matchAccounts(accounts []account) (investments, []realizedGain, error) {
+	var (
+		open           investments
+		realized       []realizedGain
+		ledger, owners = combinedLedger(accounts)
+		capacity       = make(map[int]float64)
+		pending        = make(map[int][]washAdjustment)
+	)
+
+	// shares of each purchase not yet used to replace shares sold at a
+	// loss
+	for n, t := range ledger {
+		if t.Type == "buy" {
+			capacity[n] = t.Quantity
+		}
+	}
+
+	for n, t := range ledger {
+		if err := t.validate(); err != nil {
+			return open, realized, err
+		}
+
+		a := owners[n]
+		date, _ := t.time()
+		ticker := strings.TrimSpace(strings.ToLower(t.Ticker))
+		currency := a.currency()
+		if t.Currency != "" {
+			currency = strings.ToUpper(t.Currency)
+		}
+
+		switch t.Type {
+		case "buy":
+			lot := investment{
+				Lot:      n,
+				Account:  a.Name,
+				Date:     date,
+				Ticker:   ticker,
+				Quantity: t.Quantity,
+				Price:    (t.Quantity*t.Price + t.Fee) / t.Quantity,
+				Currency: currency,
+				FxRate:   t.FxRate,
+			}
+
+			// shares replacing an earlier sale carry the disallowed loss
+			for _, adj := range pending[n] {
+				replacement := lot
+				replacement.Quantity = adj.Shares
+				replacement.Price = lot.Price + adj.PerShare
+				replacement.Date = lot.Date.AddDate(0, 0, -adj.Held)
+				open = append(open, replacement)
+				lot.Quantity = lot.Quantity - adj.Shares
+			}
+			if lot.Quantity > 1e-9 {
+				open = append(open, lot)
+			}
+		case "sell":
+			var (
+				remaining = t.Quantity
+				consumed  = make(map[int]bool)
+				first     = len(realized)
+			)
+
+			for i := range open {
+				if remaining <= 0 {
+					break
+				}
+				if open[i].Account != a.Name || open[i].Ticker != ticker || open[i].Quantity <= 0 {
+					continue
+				}
+
+				q := open[i].Quantity
+				if q > remaining {
+					q = remaining
+				}
+
+				realized = append(realized, realizedGain{
+					Account:  a.Name,
+					Ticker:   ticker,
+					Quantity: q,
+					Acquired: open[i].Date,
+					Sold:     date,
+					Proceeds: q*t.Price - t.Fee*q/t.Quantity,
+					Cost:     q * open[i].Price,
+				})
+				consumed[open[i].Lot] = true
+
+				open[i].Quantity = open[i].Quantity - q
+				remaining = remaining - q
+			}
+			if remaining > 1e-9 {
+				return open, realized, errors.New("sell of " + t.Ticker + " on " + t.Date + " exceeds the shares held")
+			}
+
+			for r := first; r < len(realized); r++ {
+				if realized[r].Proceeds < realized[r].Cost {
+					realized[r].WashSale, open = washSale(realized[r], n, ledger, consumed, capacity, pending, open)
+				}
+			}
+		}
+	}
+
+	// remove closed lots
+	var held investments
+	for _, i := range open {
+		if i.Quantity > 1e-9 {
+			held = append(held, i)
+		}
+	}
+
+	return held, realized, nil
+}
+
+// cashBalance returns the cash held across all accounts in the base
+// currency, accounts without an exchange rate are left out.
+func cashBalance() float64 {
+	var c float64
+
+	for _, a := range config.Accounts {
+		if rate, ok := fxRate(a.currency()); ok {
+			c = c + a.cash()*rate
+		}
+	}
+
+	return c
+}
+
+// netContributions returns the net amount deposited across all accounts
+// in the base currency, investments provided on the command line are
+// treated as contributed at their purchase price. Accounts without an
+// exchange rate are left out.
+func netContributions() float64 {
+	var c float64
+
+	for _, i := range cmdLnInvestments {
+		c = c + i.Quantity*i.Price
+	}
+
+	for _, a := range config.Accounts {
+		if rate, ok := fxRate(a.currency()); ok {
+			c = c + a.contributions()*rate
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAccountCash(t *testing.T) {
+	config = configuration{}
+
+	tests := []struct {
+		name          string
+		a             account
+		cash          float64
+		contributions float64
+	}{
+		{
+			"base currency",
+			account{Name: "a", Transactions: []transaction{
+				{Date: "2024-01-02", Type: "deposit", Amount: 1000},
+				{Date: "2024-01-03", Type: "buy", Ticker: "amd", Quantity: 5, Price: 100, Fee: 1},
+				{Date: "2024-02-01", Type: "dividend", Ticker: "amd", Amount: 10},
+				{Date: "2024-03-01", Type: "sell", Ticker: "amd", Quantity: 2, Price: 110, Fee: 1},
+				{Date: "2024-03-02", Type: "withdrawal", Amount: 100},
+			}},
+			1000 - 501 + 10 + 219 - 100, 900,
+		},
+		{
+			"converted at the rate of the trade",
+			account{Name: "b", Transactions: []transaction{
+				{Date: "2024-01-02", Type: "deposit", Amount: 2000},
+				{Date: "2024-01-03", Type: "buy", Ticker: "sap", Quantity: 10, Price: 100, Currency: "EUR", FxRate: 1.1},
+				{Date: "2024-01-04", Type: "deposit", Amount: 100, Currency: "eur", FxRate: 1.2},
+			}},
+			2000 - 1100 + 120, 2120,
+		},
+		{
+			"account currency",
+			account{Name: "c", Currency: "EUR", Transactions: []transaction{
+				{Date: "2024-01-02", Type: "deposit", Amount: 2000},
+				{Date: "2024-01-03", Type: "buy", Ticker: "sap", Quantity: 10, Price: 100, Currency: "EUR", FxRate: 1.1},
+			}},
+			1000, 2000,
+		},
+	}
+
+	for _, tc := range tests {
+		if got := tc.a.cash(); math.Abs(got-tc.cash) > 1e-9 {
+			t.Errorf("%s: cash = %f, want %f", tc.name, got, tc.cash)
+		}
+		if got := tc.a.contributions(); math.Abs(got-tc.contributions) > 1e-9 {
+			t.Errorf("%s: contributions = %f, want %f", tc.name, got, tc.contributions)
+		}
+	}
+}
+
+func TestValidateCurrencies(t *testing.T) {
+	buy := transaction{Date: "2024-01-03", Type: "buy", Ticker: "sap", Quantity: 10, Price: 100}
+
+	tests := []struct {
+		base     string
+		currency string
+		t        transaction
+		want     string
+	}{
+		{"", "", buy, ""},
+		{"", "EUR", buy, ""},
+		{"", "", transaction{Date: "2024-01-03", Type: "deposit", Amount: 10, Currency: "usd"}, ""},
+		{"", "", transaction{Date: "2024-01-03", Type: "deposit", Amount: 10, Currency: "EUR", FxRate: 1.1}, ""},
+		{"GBP", "gbp", transaction{Date: "2024-01-03", Type: "deposit", Amount: 10, Currency: "EUR", FxRate: 1.1}, ""},
+		{"", "", transaction{Date: "2024-01-03", Type: "deposit", Amount: 10, Currency: "EUR"}, "fxRate"},
+		{"", "EUR", transaction{Date: "2024-01-03", Type: "deposit", Amount: 10, Currency: "USD", FxRate: 1}, "must be in EUR"},
+		{"GBP", "", transaction{Date: "2024-01-03", Type: "deposit", Amount: 10, Currency: "USD"}, "fxRate"},
+	}
+
+	for _, tc := range tests {
+		err := account{Name: "a", Currency: tc.currency, Transactions: []transaction{tc.t}}.validateCurrencies(tc.base)
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s in a %q account: %v", tc.t.Currency, tc.currency, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Errorf("%s in a %q account = %v, want it to mention %q", tc.t.Currency, tc.currency, err, tc.want)
+		}
+	}
+}
@@ -2,62 +2,458 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
+
+	"github.com/TheSp1der/goerror"
 )
 
-// basicMailSend will connect to a remote mail server without authentication and send a message.
-func basicMailSend(host string, to string, from string, subject string, body string) error {
+// mailTLSConfig returns the TLS configuration used to connect to the mail
+// server, verifying the certificate against the system roots or the
+// configured certificate authority unless verification is disabled.
+func mailTLSConfig(serverName string) (*tls.Config, error) {
+	t := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: cmdLnEmailInsecure,
+	}
+
+	if cmdLnEmailCA != "" {
+		pem, err := ioutil.ReadFile(cmdLnEmailCA)
+		if err != nil {
+			return nil, err
+		}
+
+		t.RootCAs = x509.NewCertPool()
+		if !t.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + cmdLnEmailCA)
+		}
+	}
+
+	return t, nil
+}
+
+// mailConnect connects to the mail server using the configured security,
+// implicit TLS when set or the port is 465 and otherwise upgrading the
+// connection with STARTTLS when the server supports it, then
+// authenticates when a user is configured.
+func mailConnect(host string) (*smtp.Client, error) {
+	var (
+		client *smtp.Client
+		dialer = &net.Dialer{Timeout: time.Second * 30}
+		mode   = cmdLnEmailTLS
+	)
+
+	serverName, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return nil, err
+	}
+	if mode == "" {
+		mode = "starttls"
+		if port == "465" {
+			mode = "tls"
+		}
+	}
+
+	tlsConfig, err := mailTLSConfig(serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	// connect to the remote server
+	if mode == "tls" {
+		conn, err := tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		if client, err = smtp.NewClient(conn, serverName); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	} else {
+		conn, err := dialer.Dial("tcp", host)
+		if err != nil {
+			return nil, err
+		}
+		if client, err = smtp.NewClient(conn, serverName); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	// upgrade the connection, opportunistically unless it is required
+	if mode == "starttls" || mode == "require" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, err
+			}
+		} else if mode == "require" {
+			client.Close()
+			return nil, errors.New("mail server " + serverName + " does not support STARTTLS")
+		}
+	}
+
+	if cmdLnEmailUser == "" {
+		return client, nil
+	}
+
+	auth, err := mailAuth(client, serverName)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err = client.Auth(auth); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// mailAuth returns the configured authentication mechanism, or the first
+// of PLAIN, LOGIN and CRAM-MD5 the server supports when not configured.
+func mailAuth(client *smtp.Client, serverName string) (smtp.Auth, error) {
+	mechanism := strings.ToUpper(cmdLnEmailAuth)
+
+	if mechanism == "" {
+		ok, supported := client.Extension("AUTH")
+		if !ok {
+			return nil, errors.New("mail server " + serverName + " does not support authentication")
+		}
+		for _, m := range []string{"PLAIN", "LOGIN", "CRAM-MD5"} {
+			if strings.Contains(" "+strings.ToUpper(supported)+" ", " "+m+" ") {
+				mechanism = m
+				break
+			}
+		}
+	}
+
+	switch mechanism {
+	case "PLAIN":
+		return smtp.PlainAuth("", cmdLnEmailUser, cmdLnEmailPassword, serverName), nil
+	case "LOGIN":
+		return &loginAuth{username: cmdLnEmailUser, password: cmdLnEmailPassword, host: serverName}, nil
+	case "CRAM-MD5":
+		return smtp.CRAMMD5Auth(cmdLnEmailUser, cmdLnEmailPassword), nil
+	}
+
+	return nil, errors.New("mail server " + serverName + " does not support a known authentication mechanism")
+}
+
+// Start begins LOGIN authentication, the password is only sent over an
+// encrypted connection or to the local host.
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && a.host != "localhost" && a.host != "127.0.0.1" && a.host != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next answers the username and password prompts of the server.
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:", "user name", "username":
+		return []byte(a.username), nil
+	case "password:", "password":
+		return []byte(a.password), nil
+	}
+
+	return nil, errors.New("unexpected server challenge " + string(fromServer))
+}
+
+// mailAddress returns the address formatted for a header, encoding the
+// display name when it is not ASCII.
+func mailAddress(address string) string {
+	a, err := mail.ParseAddress(address)
+	if err != nil {
+		return address
+	}
+	return a.String()
+}
+
+// mailEnvelope returns the bare address of a sender or recipient for the
+// SMTP envelope.
+func mailEnvelope(address string) string {
+	a, err := mail.ParseAddress(address)
+	if err != nil {
+		return address
+	}
+	return a.Address
+}
+
+// writePart writes a quoted-printable encoded text part of the message.
+func writePart(w *multipart.Writer, contentType string, body string) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", contentType+"; charset=\"UTF-8\"")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err = qp.Write([]byte(body)); err != nil {
+		return err
+	}
+
+	return qp.Close()
+}
+
+// nestedWriter creates a multipart part of the content type and returns
+// the writer of its parts.
+func nestedWriter(w *multipart.Writer, contentType string) (*multipart.Writer, error) {
+	boundary := multipart.NewWriter(ioutil.Discard).Boundary()
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", contentType+"; boundary=\""+boundary+"\"")
+
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+
+	nested := multipart.NewWriter(part)
+
+	return nested, nested.SetBoundary(boundary)
+}
+
+// writeFile writes a base64 encoded file part of the message with the
+// disposition, inline parts are identified by their content id. Names
+// that are not ASCII are encoded as described in RFC 2231.
+func writeFile(w *multipart.Writer, disposition string, f mailPart) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", mime.FormatMediaType(f.ContentType, map[string]string{"name": f.Name}))
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": f.Name}))
+	if f.ContentID != "" {
+		header.Set("Content-ID", "<"+f.ContentID+">")
+	}
+
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	// base64 lines are limited to 76 characters
+	encoded := base64.StdEncoding.EncodeToString(f.Data)
+	for len(encoded) > 76 {
+		if _, err = part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = part.Write([]byte(encoded + "\r\n"))
+
+	return err
+}
+
+// writeAlternatives writes the plain text and HTML bodies, the HTML is
+// sent together with its inline images when there are any.
+func (m mailMessage) writeAlternatives(w *multipart.Writer) error {
+	if err := writePart(w, "text/plain", m.Text); err != nil {
+		return err
+	}
+	if len(m.Inline) == 0 {
+		return writePart(w, "text/html", m.HTML)
+	}
+
+	related, err := nestedWriter(w, "multipart/related; type=\"text/html\"")
+	if err != nil {
+		return err
+	}
+	if err = writePart(related, "text/html", m.HTML); err != nil {
+		return err
+	}
+	for _, f := range m.Inline {
+		if err = writeFile(related, "inline", f); err != nil {
+			return err
+		}
+	}
+
+	return related.Close()
+}
+
+// build returns the message in MIME format with CRLF line endings, the
+// plain text and HTML bodies are sent as alternatives followed by any
+// attachments.
+func (m mailMessage) build() ([]byte, error) {
 	var (
-		message string
-		buf     *bytes.Buffer
-		uuid    = getUUID()
+		buf     bytes.Buffer
+		to      []string
+		cc      []string
+		now     = time.Now()
+		domain  = "localhost"
+		headers [][2]string
+	)
+
+	if i := strings.LastIndex(mailEnvelope(m.From), "@"); i >= 0 {
+		domain = mailEnvelope(m.From)[i+1:]
+	}
+	for _, t := range m.To {
+		to = append(to, mailAddress(t))
+	}
+	// a message only sent as blind copies has no visible recipients
+	if len(to) == 0 {
+		to = append(to, "undisclosed-recipients:;")
+	}
+	for _, t := range m.Cc {
+		cc = append(cc, mailAddress(t))
+	}
+
+	w := multipart.NewWriter(&buf)
+
+	headers = append(headers,
+		[2]string{"Date", now.Format(time.RFC1123Z)},
+		[2]string{"Message-ID", "<" + strconv.FormatInt(now.UnixNano(), 36) + "." + getUUID() + "@" + domain + ">"},
+		[2]string{"From", mailAddress(m.From)},
+		[2]string{"To", strings.Join(to, ", ")},
 	)
+	if len(cc) > 0 {
+		headers = append(headers, [2]string{"Cc", strings.Join(cc, ", ")})
+	}
+	// blind copies are only added to the envelope
+	headers = append(headers,
+		[2]string{"Subject", mime.QEncoding.Encode("UTF-8", m.Subject)},
+		[2]string{"X-Mailer", "stockwatch"},
+		[2]string{"MIME-Version", "1.0"},
+	)
+	if len(m.Attachments) > 0 {
+		headers = append(headers, [2]string{"Content-Type", "multipart/mixed; boundary=\"" + w.Boundary() + "\""})
+	} else {
+		headers = append(headers, [2]string{"Content-Type", "multipart/alternative; boundary=\"" + w.Boundary() + "\""})
+	}
+	for _, h := range headers {
+		buf.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	// attachments follow the message in a mixed multipart
+	if len(m.Attachments) > 0 {
+		alternative, err := nestedWriter(w, "multipart/alternative")
+		if err != nil {
+			return nil, err
+		}
+		if err = m.writeAlternatives(alternative); err != nil {
+			return nil, err
+		}
+		if err = alternative.Close(); err != nil {
+			return nil, err
+		}
+		for _, f := range m.Attachments {
+			if err = writeFile(w, "attachment", f); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := m.writeAlternatives(w); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// basicMailSend will send a message, when a mail queue is configured the
+// message is queued first so it is retried if the server is unavailable.
+func basicMailSend(host string, m mailMessage) error {
+	message, err := m.build()
+	if err != nil {
+		return err
+	}
+
+	recipients := append(append(append([]string{}, m.To...), m.Cc...), m.Bcc...)
+	if cmdLnEmailQueue != "" {
+		return queueMail(host, m.From, recipients, m.Subject, message)
+	}
+
+	return deliverMail(host, m.From, recipients, message)
+}
+
+// Error returns the reply of the e-mail server.
+func (e mailRejection) Error() string {
+	return e.err.Error()
+}
+
+// mailRejected returns the error as a mailRejection when it is a permanent
+// failure reply of the e-mail server.
+func mailRejected(err error) error {
+	if reply, ok := err.(*textproto.Error); ok && reply.Code >= 500 {
+		return mailRejection{err: err}
+	}
+	return err
+}
+
+// deliverMail will connect to a remote mail server and deliver a built
+// message to the recipients. Recipients the server permanently rejects
+// are skipped, the message is only rejected when none are accepted.
+func deliverMail(host string, from string, recipients []string, message []byte) error {
+	var accepted int
+
 	// connect to the remote server
-	client, err := smtp.Dial(host)
+	client, err := mailConnect(host)
 	if err != nil {
 		return err
 	}
 	defer client.Close()
 
-	// set sender and and recipient
-	client.Mail(from)
-	client.Rcpt(to)
+	// set sender and recipients
+	if err = client.Mail(mailEnvelope(from)); err != nil {
+		return mailRejected(err)
+	}
+	for _, t := range recipients {
+		if err = client.Rcpt(mailEnvelope(t)); err != nil {
+			if _, ok := mailRejected(err).(mailRejection); !ok {
+				return err
+			}
+			goerror.Warning(errors.New("mail to " + t + " rejected: " + err.Error()))
+			continue
+		}
+		accepted++
+	}
+	if accepted == 0 {
+		return mailRejection{err: errors.New("every recipient was rejected")}
+	}
 
 	// send the body
 	mailContent, err := client.Data()
 	if err != nil {
+		return mailRejected(err)
+	}
+	if _, err = mailContent.Write(message); err != nil {
+		mailContent.Close()
 		return err
 	}
 
-	// close connection once function is complete
-	defer mailContent.Close()
-
-	message = "From: " + from + "\n"
-	message += "To: " + to + "\n"
-	message += "Subject: " + subject + "\n"
-	message += "X-Mailer: GoLang net/smtp\n"
-	message += "MIME-Version: 1.0\n"
-	message += "Content-Type: multipart/alternative; boundary=\"" + uuid + "\"\n"
-	message += "--" + uuid + "\n"
-	message += "Content-Type: text/plain; charset=\"UTF-8\"\n"
-	message += "\n"
-	message += "Please view this message in a client capable of displaying HTML\n"
-	message += "encoded messages.\n"
-	message += "\n"
-	message += "--" + uuid + "\n"
-	message += "Content-Type: text/html; charset=\"UTF-8\"\n"
-	message += "\n"
-	message += body + "\n"
-	message += "\n"
-	message += "--" + uuid + "--\n"
-	message += "\n"
-
-	// set up connection
-	buf = bytes.NewBufferString(message)
-
-	// send message
-	if _, err = buf.WriteTo(mailContent); err != nil {
-		return err
+	// the server accepts the message once the data is closed, so failing
+	// to end the session afterwards does not fail the delivery
+	if err = mailContent.Close(); err != nil {
+		return mailRejected(err)
+	}
+	if err = client.Quit(); err != nil {
+		goerror.Warning(errors.New("mail delivered but the session did not end cleanly: " + err.Error()))
 	}
 
 	return nil
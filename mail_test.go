@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"testing"
+
+	"encoding/base64"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+)
+
+// mailPartRead is a leaf part of a message and its content, decoded when
+// it is quoted-printable.
+type mailPartRead struct {
+	Header   textproto.MIMEHeader
+	FileName string
+	Data     []byte
+}
+
+// mailParts returns the leaf parts of the multipart body with the content
+// type.
+func mailParts(t *testing.T, contentType string, body []byte) []mailPartRead {
+	var parts []mailPartRead
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := ioutil.ReadAll(p)
+		if strings.HasPrefix(p.Header.Get("Content-Type"), "multipart/") {
+			parts = append(parts, mailParts(t, p.Header.Get("Content-Type"), data)...)
+			continue
+		}
+		parts = append(parts, mailPartRead{Header: p.Header, FileName: p.FileName(), Data: data})
+	}
+
+	return parts
+}
+
+func TestMailBuild(t *testing.T) {
+	var (
+		text = "Résumé of the day\n" + strings.Repeat("long line ", 20) + "\nprice=10"
+		html = "<p>Résumé</p>"
+		file = mailPart{Name: "Rapport été.csv", ContentType: "text/csv", Data: bytes.Repeat([]byte("a,b,c\n"), 40)}
+	)
+
+	tests := []struct {
+		name string
+		m    mailMessage
+		to   string
+		cc   string
+	}{
+		{
+			"recipients",
+			mailMessage{From: "Stock Watch <stock@example.com>", To: []string{"José <jose@example.com>", "sam@example.com"}, Cc: []string{"cc@example.com"}, Bcc: []string{"hidden@example.com"}},
+			"=?utf-8?q?Jos=C3=A9?= <jose@example.com>, <sam@example.com>", "<cc@example.com>",
+		},
+		{
+			"blind copies only",
+			mailMessage{From: "stock@example.com", Bcc: []string{"hidden@example.com"}},
+			"undisclosed-recipients:;", "",
+		},
+		{
+			"attachment",
+			mailMessage{From: "stock@example.com", To: []string{"sam@example.com"}, Attachments: []mailPart{file}},
+			"<sam@example.com>", "",
+		},
+		{
+			"inline image",
+			mailMessage{From: "stock@example.com", To: []string{"sam@example.com"}, Inline: []mailPart{{Name: "chart.png", ContentType: "image/png", ContentID: "chart", Data: []byte{0x89, 'P', 'N', 'G'}}}},
+			"<sam@example.com>", "",
+		},
+	}
+
+	for _, tc := range tests {
+		tc.m.Subject = "Stock Report – Montréal"
+		tc.m.Text = text
+		tc.m.HTML = html
+
+		raw, err := tc.m.build()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for _, l := range strings.Split(string(raw), "\r\n") {
+			if len(l) > 998 || strings.Contains(l, "\n") {
+				t.Errorf("%s: line %q is not CRLF terminated or too long", tc.name, l)
+			}
+		}
+
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := msg.Header.Get("To"); got != tc.to {
+			t.Errorf("%s: To = %q, want %q", tc.name, got, tc.to)
+		}
+		if got := msg.Header.Get("Cc"); got != tc.cc {
+			t.Errorf("%s: Cc = %q, want %q", tc.name, got, tc.cc)
+		}
+		if msg.Header.Get("Bcc") != "" || strings.Contains(string(raw), "hidden@example.com") {
+			t.Errorf("%s: blind copy recipients are in the message", tc.name)
+		}
+		if subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); err != nil || subject != tc.m.Subject {
+			t.Errorf("%s: Subject = %q (%v), want %q", tc.name, subject, err, tc.m.Subject)
+		}
+
+		body, _ := ioutil.ReadAll(msg.Body)
+		parts := mailParts(t, msg.Header.Get("Content-Type"), body)
+		if len(parts) != 2+len(tc.m.Inline)+len(tc.m.Attachments) {
+			t.Fatalf("%s: got %d parts", tc.name, len(parts))
+		}
+
+		// quoted-printable parts are decoded by the reader, with the line
+		// breaks of the text converted to CRLF
+		for i, want := range []string{text, html} {
+			if got := string(parts[i].Data); got != strings.Replace(want, "\n", "\r\n", -1) {
+				t.Errorf("%s: part %d = %q, want %q", tc.name, i, got, want)
+			}
+		}
+		if !strings.Contains(string(raw), "R=C3=A9sum=C3=A9") {
+			t.Errorf("%s: text is not quoted-printable", tc.name)
+		}
+
+		for i, f := range append(tc.m.Inline, tc.m.Attachments...) {
+			p := parts[2+i]
+			if p.FileName != f.Name {
+				t.Errorf("%s: file name = %q, want %q", tc.name, p.FileName, f.Name)
+			}
+			if f.ContentID != "" && p.Header.Get("Content-ID") != "<"+f.ContentID+">" {
+				t.Errorf("%s: Content-ID = %q", tc.name, p.Header.Get("Content-ID"))
+			}
+			data, _ := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(p.Data)))
+			if !bytes.Equal(data, f.Data) {
+				t.Errorf("%s: %s does not round trip", tc.name, f.Name)
+			}
+		}
+	}
+
+	// names that are not ASCII are encoded as described in RFC 2231
+	raw, _ := mailMessage{From: "stock@example.com", To: []string{"sam@example.com"}, Attachments: []mailPart{file}}.build()
+	if !strings.Contains(string(raw), "filename*=utf-8''Rapport%20%C3%A9t%C3%A9.csv") {
+		t.Error("attachment file name is not RFC 2231 encoded")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"encoding/json"
+
+	"github.com/TheSp1der/goerror"
+)
+
+// mailRetryMin and mailRetryMax bound the delay between delivery attempts
+// of a queued message, the delay doubles after every failed attempt. A
+// message claimed for longer than mailClaimTimeout is returned to the queue
+// as the process delivering it has stopped.
+const (
+	mailRetryMin     = time.Minute
+	mailRetryMax     = time.Hour
+	mailClaimTimeout = 15 * time.Minute
+)
+
+// mailQueueLock serializes loading and claiming queued messages within the
+// process, messages are claimed from other processes by renaming them.
+var mailQueueLock sync.Mutex
+
+// path returns the file the message is stored in while it is queued.
+func (q queuedMail) path() string {
+	return filepath.Join(cmdLnEmailQueue, q.ID+".json")
+}
+
+// claim takes the message from the queue for a delivery attempt by renaming
+// its file, which only one process can do. The time of the claim is kept in
+// the name of the file. It returns false when the message has already been
+// claimed, delivered or removed.
+func (q *queuedMail) claim() bool {
+	claimed := filepath.Join(cmdLnEmailQueue, q.ID+"."+strconv.FormatInt(time.Now().UnixNano(), 36)+".sending")
+	if err := os.Rename(q.path(), claimed); err != nil {
+		return false
+	}
+	q.claimed = claimed
+	return true
+}
+
+// save writes the message to the queue, the file is replaced in one step
+// so a message is never left partially written. A claimed message is
+// returned to the queue.
+func (q *queuedMail) save() error {
+	buffer, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+
+	temp := filepath.Join(cmdLnEmailQueue, q.ID+".tmp")
+	if err = ioutil.WriteFile(temp, buffer, 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(temp, q.path()); err != nil {
+		return err
+	}
+
+	if q.claimed != "" {
+		err = os.Remove(q.claimed)
+		q.claimed = ""
+	}
+
+	return err
+}
+
+// remove deletes the message, or its claim when it has been claimed, from
+// the queue.
+func (q *queuedMail) remove() error {
+	file := q.path()
+	if q.claimed != "" {
+		file = q.claimed
+	}
+
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	q.claimed = ""
+
+	return nil
+}
+
+// backoff returns the delay before the next delivery attempt.
+func (q queuedMail) backoff() time.Duration {
+	delay := mailRetryMin
+	for i := 1; i < q.Attempts && delay < mailRetryMax; i++ {
+		delay = delay * 2
+	}
+	if delay > mailRetryMax {
+		delay = mailRetryMax
+	}
+	return delay
+}
+
+// expired returns true when the message has been queued longer than the
+// expiry.
+func (q queuedMail) expired(now time.Time) bool {
+	return now.Sub(q.Created) >= time.Duration(cmdLnEmailExpiry)*time.Hour
+}
+
+// attempt delivers the claimed message and removes it from the queue, when
+// the delivery fails the next attempt is scheduled unless the server
+// rejected the message or it has expired, in which case it is discarded.
+func (q *queuedMail) attempt(host string) error {
+	err := deliverMail(host, q.From, q.Recipients, q.Message)
+	if err == nil {
+		return q.remove()
+	}
+
+	q.Attempts++
+	q.Error = err.Error()
+
+	if _, ok := err.(mailRejection); ok || q.expired(time.Now()) {
+		goerror.Warning(errors.New("mail \"" + q.Subject + "\" to " + strings.Join(q.Recipients, ", ") +
+			" discarded after " + strconv.Itoa(q.Attempts) + " attempts: " + q.Error))
+		if rerr := q.remove(); rerr != nil {
+			goerror.Warning(rerr)
+		}
+		return err
+	}
+
+	q.Next = time.Now().Add(q.backoff())
+	goerror.Warning(errors.New("mail \"" + q.Subject + "\" queued for retry at " + q.Next.Local().Format(timeFormat) + ": " + q.Error))
+	if serr := q.save(); serr != nil {
+		goerror.Warning(serr)
+	}
+
+	return err
+}
+
+// queueMail adds a built message to the queue and attempts to deliver it,
+// a failed delivery is retried later so no error is returned for it.
+func queueMail(host string, from string, recipients []string, subject string, message []byte) error {
+	var (
+		now = time.Now()
+		q   = queuedMail{
+			ID:         strconv.FormatInt(now.UnixNano(), 36),
+			From:       from,
+			Recipients: recipients,
+			Subject:    subject,
+			Message:    message,
+			Created:    now,
+			Next:       now,
+		}
+	)
+
+	mailQueueLock.Lock()
+	err := q.save()
+	claimed := err == nil && q.claim()
+	mailQueueLock.Unlock()
+
+	// send the message directly when it cannot be queued
+	if err != nil {
+		goerror.Warning(err)
+		return deliverMail(host, from, recipients, message)
+	}
+
+	if claimed {
+		q.attempt(host)
+	}
+
+	return nil
+}
+
+// loadMailQueue returns the queued messages, oldest first. Messages claimed
+// by a process that stopped before finishing the attempt are returned to the
+// queue first.
+func loadMailQueue() ([]queuedMail, error) {
+	var queue []queuedMail
+
+	claims, err := filepath.Glob(filepath.Join(cmdLnEmailQueue, "*.sending"))
+	if err != nil {
+		return queue, err
+	}
+	for _, c := range claims {
+		name := strings.Split(filepath.Base(c), ".")
+		if len(name) != 3 {
+			continue
+		}
+		if at, err := strconv.ParseInt(name[1], 36, 64); err == nil && time.Since(time.Unix(0, at)) >= mailClaimTimeout {
+			if err = os.Rename(c, filepath.Join(cmdLnEmailQueue, name[0]+".json")); err != nil && !os.IsNotExist(err) {
+				goerror.Warning(err)
+			}
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(cmdLnEmailQueue, "*.json"))
+	if err != nil {
+		return queue, err
+	}
+
+	for _, f := range files {
+		var q queuedMail
+
+		buffer, err := ioutil.ReadFile(f)
+		if err != nil {
+			return queue, err
+		}
+		if err = json.Unmarshal(buffer, &q); err != nil {
+			goerror.Warning(errors.New(f + ": " + err.Error()))
+			continue
+		}
+		queue = append(queue, q)
+	}
+
+	sort.Slice(queue, func(i, j int) bool {
+		return queue[i].Created.Before(queue[j].Created)
+	})
+
+	return queue, nil
+}
+
+// processMailQueue retries the delivery of every queued message when its
+// next attempt is due, messages are claimed before the attempts so the
+// lock is not held while the server is contacted.
+func processMailQueue() {
+	for {
+		var claimed []queuedMail
+
+		mailQueueLock.Lock()
+		queue, err := loadMailQueue()
+		if err != nil {
+			goerror.Warning(err)
+		}
+		for _, q := range queue {
+			if !q.Next.After(time.Now()) && q.claim() {
+				claimed = append(claimed, q)
+			}
+		}
+		mailQueueLock.Unlock()
+
+		for i := range claimed {
+			claimed[i].attempt(mailHost())
+		}
+
+		time.Sleep(time.Second * 30)
+	}
+}
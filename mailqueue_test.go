@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMailBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tc := range tests {
+		if got := (queuedMail{Attempts: tc.attempts}).backoff(); got != tc.want {
+			t.Errorf("backoff after %d attempts = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestMailExpired(t *testing.T) {
+	var (
+		created = time.Date(2024, 3, 14, 9, 30, 0, 0, time.UTC)
+		expiry  = cmdLnEmailExpiry
+	)
+
+	defer func() { cmdLnEmailExpiry = expiry }()
+	cmdLnEmailExpiry = 24
+
+	tests := []struct {
+		now  time.Time
+		want bool
+	}{
+		{created, false},
+		{created.Add(23 * time.Hour), false},
+		{created.Add(24 * time.Hour), true},
+		{created.Add(48 * time.Hour), true},
+	}
+
+	for _, tc := range tests {
+		if got := (queuedMail{Created: created}).expired(tc.now); got != tc.want {
+			t.Errorf("expired at %s = %v, want %v", tc.now.Sub(created), got, tc.want)
+		}
+	}
+}
+
+func TestMailClaim(t *testing.T) {
+	queue := cmdLnEmailQueue
+	defer func() { cmdLnEmailQueue = queue }()
+	cmdLnEmailQueue = t.TempDir()
+
+	q := queuedMail{ID: "abc", Subject: "report", Created: time.Now(), Next: time.Now()}
+	if err := q.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a message can only be claimed once
+	other := q
+	if !q.claim() {
+		t.Fatal("queued message was not claimed")
+	}
+	if other.claim() {
+		t.Error("claimed message was claimed again")
+	}
+	if loaded, _ := loadMailQueue(); len(loaded) != 0 {
+		t.Errorf("claimed message is in the queue: %v", loaded)
+	}
+
+	// saving a failed attempt returns the message to the queue
+	q.Attempts = 1
+	if err := q.save(); err != nil {
+		t.Fatal(err)
+	}
+	if claims, _ := filepath.Glob(filepath.Join(cmdLnEmailQueue, "*.sending")); len(claims) != 0 {
+		t.Errorf("claim was kept after saving: %v", claims)
+	}
+	if loaded, _ := loadMailQueue(); len(loaded) != 1 || loaded[0].Attempts != 1 {
+		t.Errorf("queue = %v, want the saved message", loaded)
+	}
+
+	// a claim older than the timeout is returned to the queue
+	stale := strconv.FormatInt(time.Now().Add(-mailClaimTimeout).UnixNano(), 36)
+	if err := os.Rename(q.path(), filepath.Join(cmdLnEmailQueue, q.ID+"."+stale+".sending")); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := loadMailQueue(); len(loaded) != 1 || loaded[0].ID != q.ID {
+		t.Errorf("queue = %v, want the stale claim returned", loaded)
+	}
+
+	// removing a claimed message deletes the claim
+	if !q.claim() {
+		t.Fatal("returned message was not claimed")
+	}
+	if err := q.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(cmdLnEmailQueue, "*")); len(files) != 0 {
+		t.Errorf("files left in the queue: %v", files)
+	}
+}
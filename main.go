@@ -1,9 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/TheSp1der/goerror"
@@ -11,11 +11,31 @@ import (
 )
 
 func main() {
+	setup()
+
+	// run a command instead of monitoring
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Args()); err != nil {
+			goerror.Fatal(err)
+		}
+		return
+	}
+
 	sData := make(chan iex)
 
 	// get current prices
 	go updateStockData(sData)
 
+	// maintain the price history
+	if cmdLnHistoryFile != "" {
+		go maintainHistory(time.Duration(cmdLnRetention)*time.Hour*24, time.Duration(cmdLnDownsample)*time.Minute)
+	}
+
+	// get current exchange rates
+	if cmdLnFxRates != "" {
+		go updateExchangeRates(cmdLnFxRates)
+	}
+
 	// output to console
 	if !cmdLnNoConsole {
 		go outputConsole(sData)
@@ -26,33 +46,24 @@ func main() {
 		go webListener(sData, cmdLnHTTPPort)
 	}
 
-	// end of day e-mail
-	if cmdLnEmailAddress != "" && cmdLnEmailFrom != "" && cmdLnEmailHost != "" {
-		go notifyViaMail(sData)
+	// scheduled reports by e-mail and to the notifiers
+	if mailEnabled() || len(config.Notifiers) > 0 {
+		go runReports(sData)
+	}
+
+	// retry queued e-mail
+	if mailEnabled() && cmdLnEmailQueue != "" {
+		go processMailQueue()
 	}
 
 	// if everything is fine, loop indefinitely
-	if !cmdLnNoConsole || (cmdLnHTTPPort > 0 && cmdLnHTTPPort < 65535) || (cmdLnEmailAddress != "" && cmdLnEmailFrom != "" && cmdLnEmailHost != "") {
+	if !cmdLnNoConsole || (cmdLnHTTPPort > 0 && cmdLnHTTPPort < 65535) || mailEnabled() || len(config.Notifiers) > 0 {
 		for {
 			time.Sleep(time.Duration(time.Second * 5))
 		}
 	}
 }
 
-func notifyViaMail(sData chan iex) {
-	for {
-		open, sleepTime := marketStatus()
-		if !open {
-			time.Sleep(time.Duration(time.Minute * 5))
-			if err := basicMailSend(cmdLnEmailHost+":"+strconv.Itoa(cmdLnEmailPort), cmdLnEmailAddress, cmdLnEmailFrom, "Stock Alert", displayHTML(<-sData)); err != nil {
-				goerror.Warning(err)
-			}
-		}
-
-		time.Sleep(time.Duration(sleepTime))
-	}
-}
-
 func outputConsole(sData chan iex) {
 	var hData iex
 
@@ -65,7 +76,7 @@ func outputConsole(sData chan iex) {
 		}
 
 		// display output
-		fmt.Print(displayTerminal(hData, cData))
+		fmt.Print(displayTerminal(hData, cData, recipient{}))
 
 		// update historical data
 		hData = cData
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"text/template"
+
+	"github.com/TheSp1der/goerror"
+)
+
+// notifierFuncs are the functions available to notifier templates.
+var notifierFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		buffer, err := json.Marshal(v)
+		return string(buffer), err
+	},
+}
+
+// validateNotifiers verifies every notifier has a unique name and can be
+// created.
+func (c configuration) validateNotifiers() error {
+	var names = make(map[string]bool)
+
+	for _, n := range c.Notifiers {
+		if n.Name == "" {
+			return errors.New("notifier name is required")
+		}
+		if names[n.Name] {
+			return errors.New("notifier " + n.Name + " is defined more than once")
+		}
+		names[n.Name] = true
+
+		for _, e := range n.Events {
+			if e != "alert" && e != "summary" {
+				return errors.New("notifier " + n.Name + ": unknown event \"" + e + "\"")
+			}
+		}
+		if n.Retries != nil && *n.Retries < 0 {
+			return errors.New("notifier " + n.Name + ": retries must not be negative")
+		}
+
+		if _, err := newNotifier(n); err != nil {
+			return errors.New("notifier " + n.Name + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// newNotifier returns the notifier for the configuration.
+func newNotifier(c notifierConfig) (notifier, error) {
+	switch c.Type {
+	case "webhook":
+		if c.URL == "" {
+			return nil, errors.New("url is required")
+		}
+
+		text := c.Template
+		if text == "" {
+			text = "{{json .}}"
+		}
+		t, err := template.New(c.Name).Funcs(notifierFuncs).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+
+		return &webhookNotifier{config: c, template: t}, nil
+	case "slack":
+		if c.URL == "" {
+			return nil, errors.New("url is required")
+		}
+		return &slackNotifier{config: c}, nil
+	case "matrix":
+		if c.URL == "" || c.Token == "" || c.Room == "" {
+			return nil, errors.New("url, token and room are required")
+		}
+		return &matrixNotifier{config: c}, nil
+	case "telegram":
+		if c.Token == "" || c.Chat == "" {
+			return nil, errors.New("token and chat are required")
+		}
+		return &telegramNotifier{config: c}, nil
+	case "ntfy":
+		if c.URL == "" {
+			return nil, errors.New("url is required")
+		}
+		return &ntfyNotifier{config: c}, nil
+	case "gotify":
+		if c.URL == "" || c.Token == "" {
+			return nil, errors.New("url and token are required")
+		}
+		return &gotifyNotifier{config: c}, nil
+	case "desktop":
+		return &desktopNotifier{config: c}, nil
+	}
+
+	return nil, errors.New("unknown type \"" + c.Type + "\"")
+}
+
+// wants returns true when the notifier sends notifications of the kind,
+// notifiers without events send every kind.
+func (c notifierConfig) wants(kind string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// notify sends the notification to every notifier that wants it, each
+// notifier is sent to independently so a failing one does not delay the
+// others.
+func notify(n notification) {
+	for _, c := range config.Notifiers {
+		if !c.wants(n.Kind) {
+			continue
+		}
+
+		nt, err := newNotifier(c)
+		if err != nil {
+			goerror.Warning(err)
+			continue
+		}
+
+		go func(c notifierConfig, nt notifier) {
+			if err := nt.send(n); err != nil {
+				goerror.Warning(errors.New("notifier " + c.Name + ": " + err.Error()))
+			}
+		}(c, nt)
+	}
+}
+
+// alertNotification returns the notification of the alert events.
+func alertNotification(events []alertEvent) notification {
+	n := notification{
+		Kind:         "alert",
+		Subject:      "Stock Alert: " + events[0].Message,
+		Time:         time.Now(),
+		Alerts:       events,
+		BaseCurrency: baseCurrency(),
+	}
+
+	if len(events) > 1 {
+		n.Subject = "Stock Alert: " + strconv.Itoa(len(events)) + " alerts"
+	}
+
+	return n
+}
+
+// summaryNotification returns the daily summary of the stock data, lots
+// and accounts without an exchange rate are left out of the totals, which
+// are then marked incomplete.
+func summaryNotification(stock iex) notification {
+	var mval float64
+
+	n := notification{
+		Kind:         "summary",
+		Subject:      "Stock Report",
+		Time:         time.Now(),
+		BaseCurrency: baseCurrency(),
+	}
+
+	for _, k := range stock {
+		s := summaryStock{
+			Symbol:        strings.TrimSpace(strings.ToLower(k.Company.Symbol)),
+			CompanyName:   k.Company.CompanyName,
+			Price:         k.Price,
+			Change:        k.Quote.Change,
+			ChangePercent: k.Quote.ChangePercent * 100,
+		}
+
+		for _, i := range positions {
+			if strings.TrimSpace(strings.ToLower(i.Ticker)) == s.Symbol {
+				cval, _, base, _, rated := lotGainLoss(i, k)
+				if !rated {
+					n.Incomplete = true
+					continue
+				}
+				s.GainLoss = s.GainLoss + base
+				mval = mval + cval
+			}
+		}
+
+		n.TotalGainLoss = n.TotalGainLoss + s.GainLoss
+		n.Stocks = append(n.Stocks, s)
+	}
+
+	sort.Slice(n.Stocks, func(i, j int) bool {
+		return n.Stocks[i].Symbol < n.Stocks[j].Symbol
+	})
+
+	if len(config.Accounts) > 0 {
+		n.Cash = cashBalance()
+		n.AccountValue = mval + n.Cash
+	}
+	for _, a := range config.Accounts {
+		if _, ok := fxRate(a.currency()); !ok {
+			n.Incomplete = true
+		}
+	}
+
+	return n
+}
+
+// send renders the notification with the template and posts it.
+func (w *webhookNotifier) send(n notification) error {
+	var (
+		payload bytes.Buffer
+		headers httpHeader
+	)
+
+	if err := w.template.Execute(&payload, n); err != nil {
+		return err
+	}
+	if !json.Valid(payload.Bytes()) {
+		err := errors.New("template did not produce valid JSON")
+		writeDeadLetter(w.config, payload.Bytes(), err)
+		return err
+	}
+
+	headers = append(headers, struct {
+		Name  string
+		Value string
+	}{Name: "X-Stockwatch-Event", Value: n.Kind})
+
+	if w.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.config.Secret))
+		mac.Write(payload.Bytes())
+		headers = append(headers, struct {
+			Name  string
+			Value string
+		}{Name: "X-Stockwatch-Signature", Value: "sha256=" + hex.EncodeToString(mac.Sum(nil))})
+	}
+
+	return sendWithRetry(w.config, "POST", w.config.URL, headers, "application/json", payload.Bytes())
+}
+
+// sendWithRetry sends the payload with the method, retrying with an
+// exponential backoff when the request fails or the server is
+// unavailable. Payloads that are rejected or still failing after the
+// retries are written to the dead letter file of the notifier.
+func sendWithRetry(c notifierConfig, method string, url string, headers httpHeader, contentType string, payload []byte) error {
+	var (
+		err     error
+		status  int
+		retries = 3
+		backoff = time.Second
+	)
+
+	// retries are only disabled when explicitly set to zero
+	if c.Retries != nil {
+		retries = *c.Retries
+	}
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff = backoff * 2
+			if backoff > time.Minute*5 {
+				backoff = time.Minute * 5
+			}
+		}
+
+		if _, status, err = httpSend(method, url, headers, contentType, payload); err == nil {
+			return nil
+		}
+
+		// client errors other than rate limiting will not succeed on retry
+		if status >= 400 && status < 500 && status != 429 {
+			break
+		}
+	}
+
+	writeDeadLetter(c, payload, err)
+
+	return err
+}
+
+// writeDeadLetter appends a payload that could not be delivered to the
+// dead letter file of the notifier, when one is configured.
+func writeDeadLetter(c notifierConfig, payload []byte, cause error) {
+	if c.DeadLetter == "" {
+		return
+	}
+
+	buffer, err := json.Marshal(deadLetter{
+		Time:     time.Now(),
+		Notifier: c.Name,
+		URL:      c.URL,
+		Payload:  string(payload),
+		Error:    cause.Error(),
+	})
+	if err != nil {
+		goerror.Warning(err)
+		return
+	}
+
+	f, err := os.OpenFile(c.DeadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		goerror.Warning(err)
+		return
+	}
+	defer f.Close()
+
+	if _, err = f.Write(append(buffer, '\n')); err != nil {
+		goerror.Warning(err)
+	}
+}
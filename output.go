@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -45,15 +46,17 @@ func alignRight(input string, width int) string {
 
 // displayTermnal returns a string for display in the terminal window of
 // calculated and tracked stocks and the overall gains/losses of provided
-// investments.
-func displayTerminal(hist, stock iex) string {
+// investments, limited to the subscriptions of the recipient.
+func displayTerminal(hist, stock iex, r recipient) string {
 	var (
 		err            error
 		outputTemplate *template.Template
 		data           outputStructure
 		stkHolder      []stockData
+		currency       []currencyData
 		output         bytes.Buffer
 		gtol           float64
+		mval           float64
 	)
 
 	// create the template
@@ -65,36 +68,76 @@ func displayTerminal(hist, stock iex) string {
 	tplt += "{{- range .Stock}}\n"
 	tplt += "| {{.CompanyName}} | {{.CurrentValue}} | {{.Change}} | {{.GL}} |\n"
 	tplt += "{{- end }}\n"
-	tplt += "{{- if .TotalGainLoss}}\n"
+	tplt += "{{- if or .TotalGainLoss .AccountValue}}\n"
 	tplt += "|---------------------------------'--------------'----------------'------------|\n"
+	tplt += "{{- if .TotalGainLoss}}\n"
 	tplt += "| Total Investment Value: {{.TotalGainLoss}} |\n"
+	tplt += "{{- end}}\n"
+	tplt += "{{- if .AccountValue}}\n"
+	tplt += "| Cash Balance:           {{.Cash}} |\n"
+	tplt += "| Account Value:          {{.AccountValue}} |\n"
+	tplt += "| Net Contributions:      {{.Contributions}} |\n"
+	tplt += "| Total Return:           {{.TotalReturn}} |\n"
+	tplt += "{{- end}}\n"
+	tplt += "{{- if .Sparkline}}\n"
+	tplt += "| Equity Curve:           {{.Sparkline}} |\n"
+	tplt += "{{- end}}\n"
 	tplt += "`------------------------------------------------------------------------------'\n"
 	tplt += "{{- else}}\n"
 	tplt += "`---------------------------------'--------------'----------------'------------'\n"
+	tplt += "{{- end}}\n"
+	tplt += "{{- if .Currency}}\n"
+	tplt += ".------------.----------.------------------.----------------.------------------.\n"
+	tplt += "| Ticker     | Currency |  Local Gain/Loss |      FX Effect |  Gain/Loss ({{.BaseCurrency}}) |\n"
+	tplt += "|------------|----------|------------------|----------------|------------------|\n"
+	tplt += "{{- range .Currency}}\n"
+	tplt += "| {{.Symbol}} | {{.Currency}} | {{.Local}} | {{.FX}} | {{.Base}} |\n"
+	tplt += "{{- end }}\n"
+	tplt += "`------------'----------'------------------'----------------'------------------'\n"
+	tplt += "{{- end}}\n"
+	tplt += "{{- if .Rebalance}}\n"
+	tplt += ".----------------.----------.----------.----------.----------.-----------------.\n"
+	tplt += "| Class          | Ticker   |   Target |  Current |    Drift |           Order |\n"
+	tplt += "|----------------|----------|----------|----------|----------|-----------------|\n"
+	tplt += "{{- range .Rebalance}}\n"
+	tplt += "| {{.Class}} | {{.Ticker}} | {{.Target}} | {{.Current}} | {{.Drift}} | {{.Order}} |\n"
+	tplt += "{{- end }}\n"
+	tplt += "`----------------'----------'----------'----------'----------'-----------------'\n"
+	tplt += "{{- end}}\n"
+	tplt += "{{- if .Volume}}\n"
+	tplt += ".------------.----------------.----------------.-------------------------------.\n"
+	tplt += "| Ticker     |         Volume |       Expected |     Relative Volume (Unusual) |\n"
+	tplt += "|------------|----------------|----------------|-------------------------------|\n"
+	tplt += "{{- range .Volume}}\n"
+	tplt += "| {{.Symbol}} | {{.Volume}} | {{.Expected}} | {{.Relative}} |\n"
+	tplt += "{{- end }}\n"
+	tplt += "`------------'----------------'----------------'-------------------------------'\n"
+	tplt += "{{- end}}\n"
+	tplt += "{{- if .Alerts}}\n"
+	tplt += ".---------------------.--------------------------------------------------------.\n"
+	tplt += "| Alert Time          | Alert                                                  |\n"
+	tplt += "|---------------------|--------------------------------------------------------|\n"
+	tplt += "{{- range .Alerts}}\n"
+	tplt += "| {{.Time}} | {{.Message}} |\n"
+	tplt += "{{- end }}\n"
+	tplt += "`---------------------'--------------------------------------------------------'\n"
 	tplt += "{{- end}}"
 
+	// limit the stocks to those the recipient follows
+	stock = r.stocks(stock)
+
 	for _, k := range stock {
 		var (
-			cn   string  // company name
-			cv   string  // current value
-			ch   string  // change
-			ival float64 // investment value
-			cval float64 // current value
-			diff float64 // difference
-			totl float64 // total difference
-			t    string  // total investment (string output)
+			cn string // company name
+			cv string // current value
+			ch string // change
+			t  string // total investment (string output)
 		)
 
 		// calculate the total for the ticker in the event a stock
 		// has multiple investments
-		for _, i := range cmdLnInvestments {
-			if strings.TrimSpace(strings.ToLower(k.Company.Symbol)) == strings.TrimSpace(strings.ToLower(i.Ticker)) {
-				ival = i.Quantity * i.Price
-				cval = i.Quantity * k.Price
-				diff = cval - ival
-				totl = totl + diff
-			}
-		}
+		cval, totl, byCcy, rated := tickerGainLoss(k, r.positions())
+		mval = mval + cval
 
 		// update the grand total loss/gain
 		gtol = gtol + totl
@@ -110,7 +153,9 @@ func displayTerminal(hist, stock iex) string {
 			ch = alignRight("", 14)
 		}
 
-		if totl < 0 {
+		if !rated {
+			t = alignRight("-", 10)
+		} else if totl < 0 {
 			t = color.RedString(alignRight(strconv.FormatFloat(totl, 'f', 2, 64), 10))
 		} else if totl > 0 {
 			t = color.GreenString(alignRight(strconv.FormatFloat(totl, 'f', 2, 64), 10))
@@ -118,6 +163,16 @@ func displayTerminal(hist, stock iex) string {
 			t = alignRight("", 10)
 		}
 
+		for _, c := range byCcy {
+			currency = append(currency, currencyData{
+				Symbol:   alignLeft(strings.ToUpper(k.Company.Symbol), 10),
+				Currency: alignLeft(c.Currency, 8),
+				Local:    alignRight(strconv.FormatFloat(c.Local, 'f', 2, 64), 16),
+				FX:       alignRight(strconv.FormatFloat(c.FX, 'f', 2, 64), 14),
+				Base:     alignRight(strconv.FormatFloat(c.Base, 'f', 2, 64), 16),
+			})
+		}
+
 		stkHolder = append(stkHolder, stockData{CompanyName: cn,
 			CurrentValue: cv,
 			Change:       ch,
@@ -136,6 +191,13 @@ func displayTerminal(hist, stock iex) string {
 	})
 	data.Stock = stkHolder
 
+	// sort by symbol
+	sort.SliceStable(currency, func(i, j int) bool {
+		return currency[i].Symbol < currency[j].Symbol
+	})
+	data.Currency = currency
+	data.BaseCurrency = baseCurrency()
+
 	// set the date/time and market status
 	data.CurrentTime = alignLeft(time.Now().Local().Format(timeFormat), 38)
 	if m, _ := marketStatus(); m {
@@ -149,6 +211,67 @@ func displayTerminal(hist, stock iex) string {
 		data.TotalGainLoss = color.GreenString(alignRight(strconv.FormatFloat(gtol, 'f', 2, 64), 52))
 	}
 
+	// account cash and value
+	if len(r.accounts()) > 0 {
+		cash := r.cash()
+		contrib := r.contributions()
+		ret := mval + cash - contrib
+
+		data.Cash = alignRight(strconv.FormatFloat(cash, 'f', 2, 64), 52)
+		data.AccountValue = alignRight(strconv.FormatFloat(mval+cash, 'f', 2, 64), 52)
+		data.Contributions = alignRight(strconv.FormatFloat(contrib, 'f', 2, 64), 52)
+		if ret < 0 {
+			data.TotalReturn = color.RedString(alignRight(strconv.FormatFloat(ret, 'f', 2, 64), 52))
+		} else if ret > 0 {
+			data.TotalReturn = color.GreenString(alignRight(strconv.FormatFloat(ret, 'f', 2, 64), 52))
+		} else {
+			data.TotalReturn = alignRight("", 52)
+		}
+	}
+
+	// equity curve of the recorded valuations
+	if _, values, err := history.equityCurve(startOfDay(time.Now()).AddDate(0, 0, -90)); err == nil && len(values) > 1 && r.full() {
+		if len(values) > 52 {
+			values = values[len(values)-52:]
+		}
+		data.Sparkline = alignRight(sparkline(values), 52)
+	}
+
+	// rebalance recommendations of the whole portfolio
+	if r.full() {
+		for _, o := range rebalanceOrders(stock) {
+			data.Rebalance = append(data.Rebalance, rebalanceData{
+				Class:   alignLeft(o.Class, 14),
+				Ticker:  alignLeft(strings.ToUpper(o.Ticker), 8),
+				Target:  alignRight(strconv.FormatFloat(o.Target*100, 'f', 2, 64)+"%", 8),
+				Current: alignRight(strconv.FormatFloat(o.Current*100, 'f', 2, 64)+"%", 8),
+				Drift:   alignRight(strconv.FormatFloat(o.Drift*100, 'f', 2, 64)+"%", 8),
+				Order:   alignRight(o.orderText(), 15),
+			})
+		}
+	}
+
+	// unusual volume
+	for _, v := range unusualVolume(stock) {
+		data.Volume = append(data.Volume, volumeData{
+			Symbol:   alignLeft(strings.ToUpper(v.Symbol), 10),
+			Volume:   alignRight(volumeText(float64(v.Volume)), 14),
+			Expected: alignRight(volumeText(v.Expected), 14),
+			Relative: color.YellowString(alignRight(strconv.FormatFloat(v.Relative, 'f', 2, 64)+"x", 29)),
+		})
+	}
+
+	// recent alerts
+	for _, e := range alerts.recent() {
+		if e.Ticker != "" && !r.wants(e.Ticker) {
+			continue
+		}
+		data.Alerts = append(data.Alerts, alertData{
+			Time:    e.Time.Format(timeFormat),
+			Message: alignLeft(e.Message, 54),
+		})
+	}
+
 	outputTemplate = template.Must(template.New("console").Parse(tplt))
 
 	if err = outputTemplate.Execute(&output, data); err != nil {
@@ -158,16 +281,30 @@ func displayTerminal(hist, stock iex) string {
 	return output.String()
 }
 
+// ansiEscape matches the escape sequences used to color terminal output.
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// displayText returns a string for the plain text rendition of e-mail
+// messages to the recipient, the terminal tables without colors.
+func displayText(stock iex, r recipient) string {
+	return ansiEscape.ReplaceAllString(displayTerminal(stock, stock, r), "") + "\n"
+}
+
 // displayHTML returns a string for e-mail messages of calculated and
-// tracked stocks and the overall gains/losses of provided investments.
-func displayHTML(stock iex) string {
+// tracked stocks and the overall gains/losses of provided investments,
+// limited to the subscriptions of the recipient, along with the charts
+// shown in the message.
+func displayHTML(stock iex, r recipient) (string, []mailPart) {
 	var (
 		err            error
 		outputTemplate *template.Template
 		data           outputStructure
+		charts         []mailPart
 		stkHolder      []stockData
+		currency       []currencyData
 		output         bytes.Buffer
 		gtol           float64
+		mval           float64
 	)
 
 	// create the template
@@ -198,39 +335,108 @@ func displayHTML(stock iex) string {
 		</table>
 		<br>
 		{{- if .TotalGainLoss}}
-		<span style="font-weight: bold;">Overall Performance: {{.TotalGainLoss}}</span>
+		<span style="font-weight: bold;">Overall Performance: {{.TotalGainLoss}}</span><br>
+		{{- end}}
+		{{- if .AccountValue}}
+		<span style="font-weight: bold;">Cash Balance: {{.Cash}}</span><br>
+		<span style="font-weight: bold;">Account Value: {{.AccountValue}}</span><br>
+		<span style="font-weight: bold;">Net Contributions: {{.Contributions}}</span><br>
+		<span style="font-weight: bold;">Total Return: {{.TotalReturn}}</span><br>
 		{{- end}}
 		<br>
+		{{- if .Currency}}
+		<table style="min-width: 700px;">
+			<tr style="border-bottom: 4px solid gray;">
+				<th style="text-align: left;">Ticker</th>
+				<th style="text-align: left;">Currency</th>
+				<th style="text-align: right;">Local Gain/Loss</th>
+				<th style="text-align: right;">FX Effect</th>
+				<th style="text-align: right;">Gain/Loss ({{.BaseCurrency}})</th>
+			</tr>
+			{{- range .Currency}}
+			<tr style="border-bottom: 1px solid gray;">
+				<td style="text-align: left;">{{.Symbol}}</td>
+				<td style="text-align: left;">{{.Currency}}</td>
+				<td style="text-align: right;">{{.Local}}</td>
+				<td style="text-align: right;">{{.FX}}</td>
+				<td style="text-align: right;">{{.Base}}</td>
+			</tr>
+			{{- end }}
+		</table>
 		<br>
+		{{- end}}
+		{{- if .Rebalance}}
+		<table style="min-width: 700px;">
+			<tr style="border-bottom: 4px solid gray;">
+				<th style="text-align: left;">Class</th>
+				<th style="text-align: left;">Ticker</th>
+				<th style="text-align: right;">Target</th>
+				<th style="text-align: right;">Current</th>
+				<th style="text-align: right;">Drift</th>
+				<th style="text-align: right;">Order</th>
+			</tr>
+			{{- range .Rebalance}}
+			<tr style="border-bottom: 1px solid gray;">
+				<td style="text-align: left;">{{.Class}}</td>
+				<td style="text-align: left;">{{.Ticker}}</td>
+				<td style="text-align: right;">{{.Target}}</td>
+				<td style="text-align: right;">{{.Current}}</td>
+				<td style="text-align: right;">{{.Drift}}</td>
+				<td style="text-align: right;">{{.Order}}</td>
+			</tr>
+			{{- end }}
+		</table>
+		<br>
+		{{- end}}
+		{{- if .Volume}}
+		<table style="min-width: 700px;">
+			<tr style="border-bottom: 4px solid gray;">
+				<th style="text-align: left;">Ticker</th>
+				<th style="text-align: right;">Volume</th>
+				<th style="text-align: right;">Expected</th>
+				<th style="text-align: right;">Relative Volume (Unusual)</th>
+			</tr>
+			{{- range .Volume}}
+			<tr style="border-bottom: 1px solid gray;">
+				<td style="text-align: left;">{{.Symbol}}</td>
+				<td style="text-align: right;">{{.Volume}}</td>
+				<td style="text-align: right;">{{.Expected}}</td>
+				<td style="text-align: right;">{{.Relative}}</td>
+			</tr>
+			{{- end }}
+		</table>
+		<br>
+		{{- end}}
+		<br>
+		{{- if .EquityChart}}
+		<span style="font-weight: bold;">Equity Curve</span><br>
+		<img src="cid:{{.EquityChart}}" alt="Equity Curve"><br>
+		<br>
+		{{- end}}
 		{{- range .Stock}}
+		{{- if .Chart}}
 		<a href="https://finviz.com/quote.ashx?t={{.Symbol}}">{{.CompanyName}}</a><br>
-		<img src="https://finviz.com/chart.ashx?t={{.Symbol}}"><br>
+		<img src="cid:{{.Chart}}" alt="{{.Symbol}}"><br>
+		{{- end}}
 		{{- end}}
 	</body>
 </html>`
 
+	// limit the stocks to those the recipient follows
+	stock = r.stocks(stock)
+
 	for _, k := range stock {
 		var (
-			cn   string  // company name
-			cv   string  // current value
-			ch   string  // change
-			ival float64 // // investment value
-			cval float64 // current value
-			diff float64 // difference
-			totl float64 // total difference
-			t    string  // total investment (string output)
+			cn string // company name
+			cv string // current value
+			ch string // change
+			t  string // total investment (string output)
 		)
 
 		// calculate the total for the ticker in the event a stock
 		// has multiple investments
-		for _, i := range cmdLnInvestments {
-			if strings.TrimSpace(strings.ToLower(k.Company.Symbol)) == strings.TrimSpace(strings.ToLower(i.Ticker)) {
-				ival = i.Quantity * i.Price
-				cval = i.Quantity * k.Price
-				diff = cval - ival
-				totl = totl + diff
-			}
-		}
+		cval, totl, byCcy, rated := tickerGainLoss(k, r.positions())
+		mval = mval + cval
 
 		// update the grand total loss/gain
 		gtol = gtol + totl
@@ -246,19 +452,36 @@ func displayHTML(stock iex) string {
 			ch = alignRight("", 14)
 		}
 
-		if totl < 0 {
+		if !rated {
+			t = "-"
+		} else if totl < 0 {
 			t = `<span style="color: red;">` + strconv.FormatFloat(totl, 'f', 2, 64) + "</span>"
 		} else if totl > 0 {
 			t = `<span style="color: green;">` + strconv.FormatFloat(totl, 'f', 2, 64) + "</span>"
 		}
 
-		stkHolder = append(stkHolder, stockData{
+		for _, c := range byCcy {
+			currency = append(currency, currencyData{
+				Symbol:   strings.ToUpper(k.Company.Symbol),
+				Currency: c.Currency,
+				Local:    strconv.FormatFloat(c.Local, 'f', 2, 64),
+				FX:       strconv.FormatFloat(c.FX, 'f', 2, 64),
+				Base:     strconv.FormatFloat(c.Base, 'f', 2, 64),
+			})
+		}
+
+		s := stockData{
 			CompanyName:  strings.TrimSpace(cn),
 			CurrentValue: strings.TrimSpace(cv),
 			Change:       ch,
 			GL:           t,
 			Symbol:       strings.TrimSpace(strings.ToLower(k.Company.Symbol)),
-		})
+		}
+		if chart, ok := stockChart(s.Symbol, k.Quote.Change); ok {
+			s.Chart = chart.ContentID
+			charts = append(charts, chart)
+		}
+		stkHolder = append(stkHolder, s)
 	}
 
 	// sort by symbol
@@ -271,6 +494,13 @@ func displayHTML(stock iex) string {
 	})
 	data.Stock = stkHolder
 
+	// sort by symbol
+	sort.SliceStable(currency, func(i, j int) bool {
+		return currency[i].Symbol < currency[j].Symbol
+	})
+	data.Currency = currency
+	data.BaseCurrency = baseCurrency()
+
 	// set the date/time
 	if m, _ := marketStatus(); m {
 		data.CurrentTime = `<span style="color: green;">` + time.Now().Local().Format(timeFormat) + "</span>"
@@ -285,13 +515,63 @@ func displayHTML(stock iex) string {
 		data.TotalGainLoss = `<span style="color: green;">` + strconv.FormatFloat(gtol, 'f', 2, 64) + "</span>"
 	}
 
+	// account cash and value
+	if len(r.accounts()) > 0 {
+		cash := r.cash()
+		contrib := r.contributions()
+		ret := mval + cash - contrib
+
+		data.Cash = strconv.FormatFloat(cash, 'f', 2, 64)
+		data.AccountValue = strconv.FormatFloat(mval+cash, 'f', 2, 64)
+		data.Contributions = strconv.FormatFloat(contrib, 'f', 2, 64)
+		if ret < 0 {
+			data.TotalReturn = `<span style="color: red;">` + strconv.FormatFloat(ret, 'f', 2, 64) + "</span>"
+		} else if ret > 0 {
+			data.TotalReturn = `<span style="color: green;">` + strconv.FormatFloat(ret, 'f', 2, 64) + "</span>"
+		} else {
+			data.TotalReturn = strconv.FormatFloat(ret, 'f', 2, 64)
+		}
+	}
+
+	// equity curve of the recorded valuations of all accounts
+	if r.full() {
+		if chart, ok := equityChart(); ok {
+			data.EquityChart = chart.ContentID
+			charts = append(charts, chart)
+		}
+	}
+
+	// rebalance recommendations of the whole portfolio
+	if r.full() {
+		for _, o := range rebalanceOrders(stock) {
+			data.Rebalance = append(data.Rebalance, rebalanceData{
+				Class:   o.Class,
+				Ticker:  strings.ToUpper(o.Ticker),
+				Target:  strconv.FormatFloat(o.Target*100, 'f', 2, 64) + "%",
+				Current: strconv.FormatFloat(o.Current*100, 'f', 2, 64) + "%",
+				Drift:   strconv.FormatFloat(o.Drift*100, 'f', 2, 64) + "%",
+				Order:   o.orderText(),
+			})
+		}
+	}
+
+	// unusual volume
+	for _, v := range unusualVolume(stock) {
+		data.Volume = append(data.Volume, volumeData{
+			Symbol:   strings.ToUpper(v.Symbol),
+			Volume:   volumeText(float64(v.Volume)),
+			Expected: volumeText(v.Expected),
+			Relative: `<span style="color: orange;">` + strconv.FormatFloat(v.Relative, 'f', 2, 64) + "x</span>",
+		})
+	}
+
 	outputTemplate = template.Must(template.New("console").Parse(tplt))
 
 	if err = outputTemplate.Execute(&output, data); err != nil {
 		goerror.Fatal(err)
 	}
 
-	return output.String()
+	return output.String(), charts
 }
 
 func displayWeb(stock iex) string {
@@ -300,8 +580,10 @@ func displayWeb(stock iex) string {
 		outputTemplate *template.Template
 		data           outputStructure
 		stkHolder      []stockData
+		currency       []currencyData
 		output         bytes.Buffer
 		gtol           float64
+		mval           float64
 	)
 
 	// create the template
@@ -337,7 +619,7 @@ func displayWeb(stock iex) string {
 						</thead>
 						<tbody>
 							{{- range .Stock}}
-							<tr>
+							<tr id="{{.Symbol}}">
 								<td>{{.CompanyName}}</td>
 								<td class="text-right">{{.CurrentValue}}</td>
 								<td class="text-right">{{.Change}}</td>
@@ -350,8 +632,124 @@ func displayWeb(stock iex) string {
 								<td colspan="2" class="text-right">{{.TotalGainLoss}}</td>
 							</tr>
 							{{- end}}
+							{{- if .AccountValue}}
+							<tr>
+								<td colspan="2" class="text-left font-weight-bold">Cash Balance</td>
+								<td colspan="2" class="text-right">{{.Cash}}</td>
+							</tr>
+							<tr>
+								<td colspan="2" class="text-left font-weight-bold">Account Value</td>
+								<td colspan="2" class="text-right">{{.AccountValue}}</td>
+							</tr>
+							<tr>
+								<td colspan="2" class="text-left font-weight-bold">Net Contributions</td>
+								<td colspan="2" class="text-right">{{.Contributions}}</td>
+							</tr>
+							<tr>
+								<td colspan="2" class="text-left font-weight-bold">Total Return</td>
+								<td colspan="2" class="text-right">{{.TotalReturn}}</td>
+							</tr>
+							{{- end}}
+						</tbody>
+					</table>
+					{{- if .Currency}}
+					<table class="table-sm table-striped mx-auto mt-4">
+						<thead>
+							<tr>
+								<th>Ticker</th>
+								<th>Currency</th>
+								<th class="text-right">Local Gain/Loss</th>
+								<th class="text-right">FX Effect</th>
+								<th class="text-right">Gain/Loss ({{.BaseCurrency}})</th>
+							</tr>
+						</thead>
+						<tbody>
+							{{- range .Currency}}
+							<tr>
+								<td>{{.Symbol}}</td>
+								<td>{{.Currency}}</td>
+								<td class="text-right">{{.Local}}</td>
+								<td class="text-right">{{.FX}}</td>
+								<td class="text-right">{{.Base}}</td>
+							</tr>
+							{{- end }}
+						</tbody>
+					</table>
+					{{- end}}
+					{{- if .Rebalance}}
+					<table class="table-sm table-striped mx-auto mt-4">
+						<thead>
+							<tr>
+								<th>Class</th>
+								<th>Ticker</th>
+								<th class="text-right">Target</th>
+								<th class="text-right">Current</th>
+								<th class="text-right">Drift</th>
+								<th class="text-right">Order</th>
+							</tr>
+						</thead>
+						<tbody>
+							{{- range .Rebalance}}
+							<tr>
+								<td>{{.Class}}</td>
+								<td>{{.Ticker}}</td>
+								<td class="text-right">{{.Target}}</td>
+								<td class="text-right">{{.Current}}</td>
+								<td class="text-right">{{.Drift}}</td>
+								<td class="text-right">{{.Order}}</td>
+							</tr>
+							{{- end }}
+						</tbody>
+					</table>
+					{{- end}}
+					{{- if .Volume}}
+					<table class="table-sm table-striped mx-auto mt-4">
+						<thead>
+							<tr>
+								<th>Ticker</th>
+								<th class="text-right">Volume</th>
+								<th class="text-right">Expected</th>
+								<th class="text-right">Relative Volume (Unusual)</th>
+							</tr>
+						</thead>
+						<tbody>
+							{{- range .Volume}}
+							<tr>
+								<td>{{.Symbol}}</td>
+								<td class="text-right">{{.Volume}}</td>
+								<td class="text-right">{{.Expected}}</td>
+								<td class="text-right">{{.Relative}}</td>
+							</tr>
+							{{- end }}
+						</tbody>
+					</table>
+					{{- end}}
+					{{- if .Alerts}}
+					<table class="table-sm table-striped mx-auto mt-4">
+						<thead>
+							<tr>
+								<th>Alert Time</th>
+								<th>Alert</th>
+							</tr>
+						</thead>
+						<tbody>
+							{{- range .Alerts}}
+							<tr>
+								<td>{{.Time}}</td>
+								<td>{{.Message}}</td>
+							</tr>
+							{{- end }}
 						</tbody>
 					</table>
+					{{- end}}
+					{{- if .EquityChart}}
+					<div class="text-center mt-4">
+						<h6>Equity Curve</h6>
+						{{.EquityChart}}
+						<h6 class="mt-2">Drawdown</h6>
+						{{.DrawdownChart}}
+					</div>
+					{{- end}}
 				</div>
 			</main>
 			<footer class="container mt-2">
@@ -365,26 +763,16 @@ func displayWeb(stock iex) string {
 
 	for _, k := range stock {
 		var (
-			cn   string  // company name
-			cv   string  // current value
-			ch   string  // change
-			ival float64 // // investment value
-			cval float64 // current value
-			diff float64 // difference
-			totl float64 // total difference
-			t    string  // total investment (string output)
+			cn string // company name
+			cv string // current value
+			ch string // change
+			t  string // total investment (string output)
 		)
 
 		// calculate the total for the ticker in the event a stock
 		// has multiple investments
-		for _, i := range cmdLnInvestments {
-			if strings.TrimSpace(strings.ToLower(k.Company.Symbol)) == strings.TrimSpace(strings.ToLower(i.Ticker)) {
-				ival = i.Quantity * i.Price
-				cval = i.Quantity * k.Price
-				diff = cval - ival
-				totl = totl + diff
-			}
-		}
+		cval, totl, byCcy, rated := tickerGainLoss(k, positions)
+		mval = mval + cval
 
 		// update the grand total loss/gain
 		gtol = gtol + totl
@@ -400,12 +788,24 @@ func displayWeb(stock iex) string {
 			ch = alignRight("", 14)
 		}
 
-		if totl < 0 {
+		if !rated {
+			t = "-"
+		} else if totl < 0 {
 			t = `<span style="color: red;">` + strconv.FormatFloat(totl, 'f', 2, 64) + "</span>"
 		} else if totl > 0 {
 			t = `<span style="color: green;">` + strconv.FormatFloat(totl, 'f', 2, 64) + "</span>"
 		}
 
+		for _, c := range byCcy {
+			currency = append(currency, currencyData{
+				Symbol:   strings.ToUpper(k.Company.Symbol),
+				Currency: c.Currency,
+				Local:    strconv.FormatFloat(c.Local, 'f', 2, 64),
+				FX:       strconv.FormatFloat(c.FX, 'f', 2, 64),
+				Base:     strconv.FormatFloat(c.Base, 'f', 2, 64),
+			})
+		}
+
 		stkHolder = append(stkHolder, stockData{
 			CompanyName:  strings.TrimSpace(cn),
 			CurrentValue: strings.TrimSpace(cv),
@@ -425,6 +825,13 @@ func displayWeb(stock iex) string {
 	})
 	data.Stock = stkHolder
 
+	// sort by symbol
+	sort.SliceStable(currency, func(i, j int) bool {
+		return currency[i].Symbol < currency[j].Symbol
+	})
+	data.Currency = currency
+	data.BaseCurrency = baseCurrency()
+
 	// set the date/time
 	if m, _ := marketStatus(); m {
 		data.CurrentTime = `<span style="color: green;">` + time.Now().Local().Format(timeFormat) + "</span>"
@@ -439,6 +846,60 @@ func displayWeb(stock iex) string {
 		data.TotalGainLoss = `<span style="color: green;">` + strconv.FormatFloat(gtol, 'f', 2, 64) + "</span>"
 	}
 
+	// account cash and value
+	if len(config.Accounts) > 0 {
+		cash := cashBalance()
+		contrib := netContributions()
+		ret := mval + cash - contrib
+
+		data.Cash = strconv.FormatFloat(cash, 'f', 2, 64)
+		data.AccountValue = strconv.FormatFloat(mval+cash, 'f', 2, 64)
+		data.Contributions = strconv.FormatFloat(contrib, 'f', 2, 64)
+		if ret < 0 {
+			data.TotalReturn = `<span style="color: red;">` + strconv.FormatFloat(ret, 'f', 2, 64) + "</span>"
+		} else if ret > 0 {
+			data.TotalReturn = `<span style="color: green;">` + strconv.FormatFloat(ret, 'f', 2, 64) + "</span>"
+		} else {
+			data.TotalReturn = strconv.FormatFloat(ret, 'f', 2, 64)
+		}
+	}
+
+	// equity curve and drawdown of the recorded valuations
+	if _, values, err := history.equityCurve(startOfDay(time.Now()).AddDate(-1, 0, 0)); err == nil && len(values) > 1 {
+		data.EquityChart = svgChart(values, 600, 150, "#007bff", false)
+		data.DrawdownChart = svgChart(drawdown(values), 600, 100, "#dc3545", true)
+	}
+
+	// rebalance recommendations
+	for _, o := range rebalanceOrders(stock) {
+		data.Rebalance = append(data.Rebalance, rebalanceData{
+			Class:   o.Class,
+			Ticker:  strings.ToUpper(o.Ticker),
+			Target:  strconv.FormatFloat(o.Target*100, 'f', 2, 64) + "%",
+			Current: strconv.FormatFloat(o.Current*100, 'f', 2, 64) + "%",
+			Drift:   strconv.FormatFloat(o.Drift*100, 'f', 2, 64) + "%",
+			Order:   o.orderText(),
+		})
+	}
+
+	// unusual volume
+	for _, v := range unusualVolume(stock) {
+		data.Volume = append(data.Volume, volumeData{
+			Symbol:   strings.ToUpper(v.Symbol),
+			Volume:   volumeText(float64(v.Volume)),
+			Expected: volumeText(v.Expected),
+			Relative: `<span style="color: orange;">` + strconv.FormatFloat(v.Relative, 'f', 2, 64) + "x</span>",
+		})
+	}
+
+	// recent alerts
+	for _, e := range alerts.recent() {
+		data.Alerts = append(data.Alerts, alertData{
+			Time:    e.Time.Format(timeFormat),
+			Message: e.Message,
+		})
+	}
+
 	outputTemplate = template.Must(template.New("console").Parse(tplt))
 
 	if err = outputTemplate.Execute(&output, data); err != nil {
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"time"
+
+	"encoding/binary"
+)
+
+// parquet physical types, converted types and thrift compact protocol
+// field types used when writing files
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+
+	parquetRowGroupSize = 10000
+)
+
+// varint writes an unsigned variable length integer.
+func (t *thriftWriter) varint(v uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	t.Write(buf[:binary.PutUvarint(buf, v)])
+}
+
+// field writes a field header, using the short form when the field id
+// is within 15 of the previous field.
+func (t *thriftWriter) field(id int, kind byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta<<4) | kind)
+	} else {
+		t.WriteByte(kind)
+		t.varint(uint64((id << 1) ^ (id >> 31)))
+	}
+	t.last = id
+}
+
+// i32 writes a 32 bit integer field.
+func (t *thriftWriter) i32(id int, v int32) {
+	t.field(id, thriftI32)
+	t.varint(uint64(uint32((v << 1) ^ (v >> 31))))
+}
+
+// i64 writes a 64 bit integer field.
+func (t *thriftWriter) i64(id int, v int64) {
+	t.field(id, thriftI64)
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+// str writes a string field.
+func (t *thriftWriter) str(id int, v string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(v)))
+	t.WriteString(v)
+}
+
+// list writes the header of a list field, the elements follow.
+func (t *thriftWriter) list(id int, kind byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.WriteByte(byte(size<<4) | kind)
+	} else {
+		t.WriteByte(0xf0 | kind)
+		t.varint(uint64(size))
+	}
+}
+
+// begin starts a nested structure, either as a field or as a list
+// element when the id is zero.
+func (t *thriftWriter) begin(id int) {
+	if id > 0 {
+		t.field(id, thriftStruct)
+	}
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+// end finishes a nested structure.
+func (t *thriftWriter) end() {
+	t.WriteByte(0)
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// newParquetWriter writes the parquet header and returns a writer for
+// rows with the columns.
+func newParquetWriter(w io.Writer, columns []exportColumn) (*parquetWriter, error) {
+	p := &parquetWriter{w: w, columns: columns}
+	return p, p.output([]byte("PAR1"))
+}
+
+// output writes to the underlying writer tracking the file offset.
+func (p *parquetWriter) output(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset = p.offset + int64(n)
+	return err
+}
+
+// write buffers the row, writing a row group once it is full.
+func (p *parquetWriter) write(row []interface{}) error {
+	p.rows = append(p.rows, row)
+	if len(p.rows) >= parquetRowGroupSize {
+		return p.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group with a single plain
+// encoded, uncompressed data page per column.
+func (p *parquetWriter) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+
+	group := parquetRowGroup{Rows: int64(len(p.rows))}
+
+	for c, col := range p.columns {
+		var (
+			data   bytes.Buffer
+			header thriftWriter
+			buf    = make([]byte, 8)
+		)
+
+		for _, row := range p.rows {
+			switch col.Type {
+			case "string":
+				s, _ := row[c].(string)
+				binary.LittleEndian.PutUint32(buf, uint32(len(s)))
+				data.Write(buf[:4])
+				data.WriteString(s)
+			case "double":
+				f, _ := row[c].(float64)
+				binary.LittleEndian.PutUint64(buf, math.Float64bits(f))
+				data.Write(buf)
+			case "int64":
+				i, _ := row[c].(int64)
+				binary.LittleEndian.PutUint64(buf, uint64(i))
+				data.Write(buf)
+			case "timestamp":
+				t, _ := row[c].(time.Time)
+				binary.LittleEndian.PutUint64(buf, uint64(t.UnixNano()/int64(time.Millisecond)))
+				data.Write(buf)
+			}
+		}
+
+		// page header
+		header.i32(1, 0)
+		header.i32(2, int32(data.Len()))
+		header.i32(3, int32(data.Len()))
+		header.begin(5)
+		header.i32(1, int32(len(p.rows)))
+		header.i32(2, 0)
+		header.i32(3, 3)
+		header.i32(4, 3)
+		header.end()
+		header.WriteByte(0)
+
+		chunk := parquetChunk{Offset: p.offset, Size: int64(header.Len() + data.Len())}
+		if err := p.output(header.Bytes()); err != nil {
+			return err
+		}
+		if err := p.output(data.Bytes()); err != nil {
+			return err
+		}
+		group.Chunks = append(group.Chunks, chunk)
+	}
+
+	p.groups = append(p.groups, group)
+	p.rows = nil
+
+	return nil
+}
+
+// close writes any buffered rows followed by the file metadata.
+func (p *parquetWriter) close() error {
+	var (
+		meta  thriftWriter
+		total int64
+		buf   = make([]byte, 4)
+	)
+
+	if err := p.flush(); err != nil {
+		return err
+	}
+
+	for _, g := range p.groups {
+		total = total + g.Rows
+	}
+
+	meta.i32(1, 1)
+
+	// schema
+	meta.list(2, thriftStruct, len(p.columns)+1)
+	meta.begin(0)
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(p.columns)))
+	meta.end()
+	for _, col := range p.columns {
+		meta.begin(0)
+		meta.i32(1, int32(col.physical()))
+		meta.i32(3, 0)
+		meta.str(4, col.Name)
+		switch col.Type {
+		case "string":
+			meta.i32(6, parquetUTF8)
+		case "timestamp":
+			meta.i32(6, parquetTimestampMillis)
+		}
+		meta.end()
+	}
+
+	meta.i64(3, total)
+
+	// row groups
+	meta.list(4, thriftStruct, len(p.groups))
+	for _, g := range p.groups {
+		var size int64
+
+		meta.begin(0)
+		meta.list(1, thriftStruct, len(g.Chunks))
+		for c, chunk := range g.Chunks {
+			size = size + chunk.Size
+
+			meta.begin(0)
+			meta.i64(2, chunk.Offset)
+			meta.begin(3)
+			meta.i32(1, int32(p.columns[c].physical()))
+			meta.list(2, thriftI32, 1)
+			meta.varint(0)
+			meta.list(3, thriftBinary, 1)
+			meta.varint(uint64(len(p.columns[c].Name)))
+			meta.WriteString(p.columns[c].Name)
+			meta.i32(4, 0)
+			meta.i64(5, g.Rows)
+			meta.i64(6, chunk.Size)
+			meta.i64(7, chunk.Size)
+			meta.i64(9, chunk.Offset)
+			meta.end()
+			meta.end()
+		}
+		meta.i64(2, size)
+		meta.i64(3, g.Rows)
+		meta.end()
+	}
+
+	meta.str(6, "stockwatch")
+	meta.WriteByte(0)
+
+	if err := p.output(meta.Bytes()); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(buf, uint32(meta.Len()))
+	if err := p.output(buf); err != nil {
+		return err
+	}
+
+	return p.output([]byte("PAR1"))
+}
+
+// physical returns the parquet physical type of the column.
+func (c exportColumn) physical() int {
+	switch c.Type {
+	case "string":
+		return parquetByteArray
+	case "double":
+		return parquetDouble
+	}
+	return parquetInt64
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestParquetWriter(t *testing.T) {
+	var (
+		output  bytes.Buffer
+		columns = []exportColumn{
+			{Name: "symbol", Type: "string"},
+			{Name: "time", Type: "timestamp"},
+			{Name: "price", Type: "double"},
+			{Name: "volume", Type: "int64"},
+		}
+		start = time.Date(2024, 1, 2, 14, 30, 0, 0, time.UTC)
+		rows  [][]interface{}
+	)
+
+	// enough rows for more than one row group
+	for n := 0; n < parquetRowGroupSize+5; n++ {
+		rows = append(rows, []interface{}{
+			[]string{"amd", "googl", ""}[n%3],
+			start.Add(time.Duration(n) * time.Minute),
+			100 + float64(n)/4,
+			int64(n * 1000),
+		})
+	}
+
+	p, err := newParquetWriter(&output, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err = p.write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = p.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := buffer.NewBufferFile(output.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+
+	if pr.GetNumRows() != int64(len(rows)) {
+		t.Fatalf("read %d rows, want %d", pr.GetNumRows(), len(rows))
+	}
+	if len(pr.Footer.RowGroups) != 2 {
+		t.Errorf("read %d row groups, want 2", len(pr.Footer.RowGroups))
+	}
+
+	for c, col := range columns {
+		values, _, _, err := pr.ReadColumnByIndex(int64(c), int64(len(rows)))
+		if err != nil {
+			t.Fatalf("column %s: %v", col.Name, err)
+		}
+		if len(values) != len(rows) {
+			t.Fatalf("column %s: read %d values, want %d", col.Name, len(values), len(rows))
+		}
+
+		for n, v := range values {
+			var want interface{}
+			switch col.Type {
+			case "timestamp":
+				want = rows[n][c].(time.Time).UnixNano() / int64(time.Millisecond)
+			default:
+				want = rows[n][c]
+			}
+			if v != want {
+				t.Errorf("column %s row %d = %v, want %v", col.Name, n, v, want)
+				break
+			}
+		}
+	}
+}
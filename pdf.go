@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"compress/zlib"
+	"encoding/xml"
+	"image/png"
+)
+
+// page size, margin and text size of PDF reports in points
+const (
+	pdfPageWidth  = 612
+	pdfPageHeight = 792
+	pdfMargin     = 36
+	pdfFontSize   = 9
+	pdfLeading    = 12
+	pdfRowHeight  = 15
+	pdfCellPad    = 4
+)
+
+// pdfFonts are the standard fonts of PDF reports by resource name.
+var pdfFonts = []struct{ Name, BaseFont string }{
+	{"F1", "Helvetica"},
+	{"F2", "Helvetica-Bold"},
+	{"F3", "Courier"},
+}
+
+// pdfColors are the fill colours of the colours used in the HTML report.
+var pdfColors = map[string]string{
+	"red":    "0.8 0 0 rg",
+	"green":  "0 0.5 0 rg",
+	"orange": "0.9 0.5 0 rg",
+	"gray":   "0.5 0.5 0.5 rg",
+	"blue":   "0 0.3 0.7 rg",
+}
+
+// helveticaWidths and helveticaBoldWidths are the widths of the printable
+// ASCII characters from space in thousandths of the font size, taken from
+// the metrics of the standard fonts.
+var (
+	helveticaWidths = []int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = []int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// pdfText returns the line escaped for a PDF string in a standard font,
+// block characters are shown as their nearest ASCII and other characters
+// it cannot show as question marks.
+func pdfText(line string) string {
+	var (
+		text   strings.Builder
+		blocks = []rune("▁▂▃▄▅▆▇█")
+		ramp   = "_.,-=+*#"
+	)
+
+	for _, c := range line {
+		for i, b := range blocks {
+			if c == b {
+				c = rune(ramp[i])
+			}
+		}
+
+		switch {
+		case c == '\\' || c == '(' || c == ')':
+			text.WriteString("\\" + string(c))
+		case c < 32:
+		case c > 255:
+			text.WriteByte('?')
+		default:
+			text.WriteByte(byte(c))
+		}
+	}
+
+	return text.String()
+}
+
+// pdfWidth returns the width of the text in points in the font.
+func pdfWidth(text string, font string) float64 {
+	var width int
+
+	for _, c := range text {
+		switch {
+		case font == "F3":
+			width = width + 600
+		case c < 32:
+		case c > 126:
+			width = width + 556
+		case font == "F2":
+			width = width + helveticaBoldWidths[c-32]
+		default:
+			width = width + helveticaWidths[c-32]
+		}
+	}
+
+	return float64(width) * pdfFontSize / 1000
+}
+
+// runsWidth returns the width of the runs in points.
+func runsWidth(runs []pdfRun) float64 {
+	var width float64
+
+	for _, r := range runs {
+		width = width + pdfWidth(r.Text, r.Font)
+	}
+
+	return width
+}
+
+// trimRuns removes the white space before the first and after the last
+// run, dropping runs left empty.
+func trimRuns(runs []pdfRun) []pdfRun {
+	var trimmed []pdfRun
+
+	for i, r := range runs {
+		if i == 0 || len(trimmed) == 0 {
+			r.Text = strings.TrimLeft(r.Text, " ")
+		}
+		if r.Text != "" {
+			trimmed = append(trimmed, r)
+		}
+	}
+	for len(trimmed) > 0 {
+		last := &trimmed[len(trimmed)-1]
+		if last.Text = strings.TrimRight(last.Text, " "); last.Text != "" {
+			break
+		}
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+
+	return trimmed
+}
+
+// newPage finishes the current page and starts another.
+func (l *pdfLayout) newPage() {
+	l.pages = append(l.pages, l.page.String())
+	l.page.Reset()
+	l.y = pdfPageHeight - pdfMargin
+}
+
+// space starts a new page unless the height fits on the current page.
+func (l *pdfLayout) space(height float64) {
+	if l.y-height < pdfMargin && l.y < pdfPageHeight-pdfMargin {
+		l.newPage()
+	}
+}
+
+// text draws the runs with the first starting at the position.
+func (l *pdfLayout) text(x float64, y float64, runs []pdfRun) {
+	for _, r := range runs {
+		color := r.Color
+		if color == "" {
+			color = "0 0 0 rg"
+		}
+		l.page.WriteString("BT /" + r.Font + " " + strconv.Itoa(pdfFontSize) + " Tf " + color + " " +
+			strconv.FormatFloat(x, 'f', 2, 64) + " " + strconv.FormatFloat(y, 'f', 2, 64) + " Td (" + pdfText(r.Text) + ") Tj ET\n")
+		x = x + pdfWidth(r.Text, r.Font)
+	}
+}
+
+// rule draws a horizontal line across the content of the page.
+func (l *pdfLayout) rule(y float64, width float64) {
+	l.page.WriteString("0.5 0.5 0.5 RG " + strconv.FormatFloat(width, 'f', 2, 64) + " w " +
+		strconv.Itoa(pdfMargin) + " " + strconv.FormatFloat(y, 'f', 2, 64) + " m " +
+		strconv.Itoa(pdfPageWidth-pdfMargin) + " " + strconv.FormatFloat(y, 'f', 2, 64) + " l S\n")
+}
+
+// line draws a line of text, or leaves a gap when the line is empty.
+func (l *pdfLayout) line(runs []pdfRun) {
+	runs = trimRuns(runs)
+	if len(runs) == 0 {
+		l.y = l.y - pdfLeading/2
+		return
+	}
+
+	l.space(pdfLeading)
+	l.y = l.y - pdfLeading
+	l.text(pdfMargin, l.y+3, runs)
+}
+
+// table draws the rows as a table across the page, columns are as wide as
+// their widest cell with the remaining width shared between them.
+func (l *pdfLayout) table(rows [][]pdfCell) {
+	var (
+		widths  []float64
+		total   float64
+		content = float64(pdfPageWidth - 2*pdfMargin)
+	)
+
+	for _, row := range rows {
+		for c, cell := range row {
+			if c >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := runsWidth(trimRuns(cell.Runs)) + 2*pdfCellPad; w > widths[c] {
+				widths[c] = w
+			}
+		}
+	}
+	for _, w := range widths {
+		total = total + w
+	}
+	if total == 0 {
+		return
+	}
+	for c := range widths {
+		if total < content {
+			widths[c] = widths[c] + (content-total)/float64(len(widths))
+		} else {
+			widths[c] = widths[c] * content / total
+		}
+	}
+
+	for _, row := range rows {
+		var header bool
+
+		l.space(pdfRowHeight)
+		l.y = l.y - pdfRowHeight
+
+		x := float64(pdfMargin)
+		for c, cell := range row {
+			runs := trimRuns(cell.Runs)
+			for _, r := range runs {
+				header = header || r.Font == "F2"
+			}
+			if cell.Right {
+				l.text(x+widths[c]-pdfCellPad-runsWidth(runs), l.y+4, runs)
+			} else {
+				l.text(x+pdfCellPad, l.y+4, runs)
+			}
+			x = x + widths[c]
+		}
+
+		if header {
+			l.rule(l.y, 1.5)
+		} else {
+			l.rule(l.y, 0.25)
+		}
+	}
+	l.y = l.y - pdfLeading/2
+}
+
+// image draws the PNG image across the page.
+func (l *pdfLayout) image(data []byte) error {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	var (
+		bounds = img.Bounds()
+		pixels bytes.Buffer
+		width  = float64(pdfPageWidth - 2*pdfMargin)
+		height = width * float64(bounds.Dy()) / float64(bounds.Dx())
+		name   = "Im" + strconv.Itoa(len(l.images)+1)
+	)
+
+	z := zlib.NewWriter(&pixels)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			r, g, b, _ := img.At(px, py).RGBA()
+			z.Write([]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8)})
+		}
+	}
+	if err = z.Close(); err != nil {
+		return err
+	}
+
+	l.images = append(l.images, "<< /Type /XObject /Subtype /Image /Width "+strconv.Itoa(bounds.Dx())+" /Height "+strconv.Itoa(bounds.Dy())+
+		" /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length "+strconv.Itoa(pixels.Len())+" >>\nstream\n"+
+		pixels.String()+"\nendstream")
+
+	l.space(height + 4)
+	l.y = l.y - height - 4
+	l.page.WriteString("q " + strconv.FormatFloat(width, 'f', 2, 64) + " 0 0 " + strconv.FormatFloat(height, 'f', 2, 64) + " " +
+		strconv.Itoa(pdfMargin) + " " + strconv.FormatFloat(l.y, 'f', 2, 64) + " cm /" + name + " Do Q\n")
+
+	return nil
+}
+
+// document returns the laid out pages as a PDF document.
+func (l *pdfLayout) document() []byte {
+	var (
+		buf     bytes.Buffer
+		objects []string
+		fonts   []string
+		images  []string
+		kids    []string
+	)
+
+	l.newPage()
+
+	// objects are numbered from one in the order they are added
+	add := func(object string) int {
+		objects = append(objects, object)
+		return len(objects)
+	}
+
+	catalog := add("")
+	root := add("")
+	for _, f := range pdfFonts {
+		id := add("<< /Type /Font /Subtype /Type1 /BaseFont /" + f.BaseFont + " /Encoding /WinAnsiEncoding >>")
+		fonts = append(fonts, "/"+f.Name+" "+strconv.Itoa(id)+" 0 R")
+	}
+	for i, img := range l.images {
+		images = append(images, "/Im"+strconv.Itoa(i+1)+" "+strconv.Itoa(add(img))+" 0 R")
+	}
+
+	resources := "<< /Font << " + strings.Join(fonts, " ") + " >>"
+	if len(images) > 0 {
+		resources += " /XObject << " + strings.Join(images, " ") + " >>"
+	}
+	resources += " >>"
+
+	for _, content := range l.pages {
+		stream := add("<< /Length " + strconv.Itoa(len(content)) + " >>\nstream\n" + content + "endstream")
+		kids = append(kids, strconv.Itoa(add("<< /Type /Page /Parent "+strconv.Itoa(root)+" 0 R /MediaBox [0 0 "+
+			strconv.Itoa(pdfPageWidth)+" "+strconv.Itoa(pdfPageHeight)+"] /Resources "+resources+" /Contents "+strconv.Itoa(stream)+" 0 R >>"))+" 0 R")
+	}
+	objects[catalog-1] = "<< /Type /Catalog /Pages " + strconv.Itoa(root) + " 0 R >>"
+	objects[root-1] = "<< /Type /Pages /Kids [" + strings.Join(kids, " ") + "] /Count " + strconv.Itoa(len(kids)) + " >>"
+
+	// the cross reference table holds the byte offset of every object
+	offsets := make([]int, len(objects))
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	for i, o := range objects {
+		offsets[i] = buf.Len()
+		buf.WriteString(strconv.Itoa(i+1) + " 0 obj\n" + o + "\nendobj\n")
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n0 " + strconv.Itoa(len(objects)+1) + "\n0000000000 65535 f \n")
+	for _, o := range offsets {
+		offset := strconv.Itoa(o)
+		buf.WriteString(strings.Repeat("0", 10-len(offset)) + offset + " 00000 n \n")
+	}
+	buf.WriteString("trailer\n<< /Size " + strconv.Itoa(len(objects)+1) + " /Root " + strconv.Itoa(catalog) + " 0 R >>\nstartxref\n" + strconv.Itoa(xref) + "\n%%EOF\n")
+
+	return buf.Bytes()
+}
+
+// reportPDF renders the HTML report as a PDF document of US Letter pages,
+// the text in proportional fonts with the bold and colours of the HTML,
+// the tables laid out in columns and the inline charts as images.
+func reportPDF(body string, charts []mailPart) ([]byte, error) {
+	var (
+		layout = &pdfLayout{y: pdfPageHeight - pdfMargin}
+		styles = []pdfRun{{Font: "F1"}}
+		spaces = regexp.MustCompile(`\s+`)
+		line   []pdfRun
+		rows   [][]pdfCell
+		table  bool
+		cell   bool
+		pre    bool
+		hidden int
+	)
+
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	// add appends text to the current table cell or line
+	add := func(text string) {
+		run := styles[len(styles)-1]
+		run.Text = text
+		if !table {
+			line = append(line, run)
+			return
+		}
+		if cell && len(rows) > 0 && len(rows[len(rows)-1]) > 0 {
+			row := rows[len(rows)-1]
+			row[len(row)-1].Runs = append(row[len(row)-1].Runs, run)
+		}
+	}
+	flush := func() {
+		if len(line) > 0 {
+			layout.line(line)
+		}
+		line = nil
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			var (
+				name  = strings.ToLower(t.Name.Local)
+				style = styles[len(styles)-1]
+				attr  = make(map[string]string)
+			)
+			for _, a := range t.Attr {
+				attr[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			css := strings.ToLower(strings.Replace(attr["style"], " ", "", -1))
+
+			if strings.Contains(css, "font-weight:bold") {
+				style.Font = "F2"
+			}
+			for _, property := range strings.Split(css, ";") {
+				if strings.HasPrefix(property, "color:") {
+					style.Color = pdfColors[strings.TrimPrefix(property, "color:")]
+				}
+			}
+
+			switch name {
+			case "head", "script", "style":
+				hidden++
+			case "b", "strong", "h1", "h2", "h3", "h4":
+				style.Font = "F2"
+			case "a":
+				style.Color = pdfColors["blue"]
+			case "br":
+				if !table {
+					layout.line(line)
+					line = nil
+				}
+			case "table":
+				flush()
+				table = true
+				rows = nil
+			case "tr":
+				rows = append(rows, nil)
+			case "th", "td":
+				if name == "th" {
+					style.Font = "F2"
+				}
+				if len(rows) > 0 {
+					rows[len(rows)-1] = append(rows[len(rows)-1], pdfCell{Right: strings.Contains(css, "text-align:right")})
+					cell = true
+				}
+			case "img":
+				for _, c := range charts {
+					if "cid:"+c.ContentID == attr["src"] {
+						flush()
+						if err = layout.image(c.Data); err != nil {
+							return nil, err
+						}
+					}
+				}
+			case "pre":
+				flush()
+				pre = true
+				style.Font = "F3"
+			case "p", "div", "ul", "li":
+				flush()
+			}
+			styles = append(styles, style)
+		case xml.EndElement:
+			if len(styles) > 1 {
+				styles = styles[:len(styles)-1]
+			}
+
+			switch strings.ToLower(t.Name.Local) {
+			case "head", "script", "style":
+				hidden--
+			case "th", "td":
+				cell = false
+			case "table":
+				layout.table(rows)
+				table = false
+			case "pre":
+				flush()
+				pre = false
+			case "p", "div", "ul", "li", "h1", "h2", "h3", "h4", "body":
+				flush()
+			}
+		case xml.CharData:
+			if hidden > 0 {
+				continue
+			}
+			if !pre {
+				add(spaces.ReplaceAllString(string(t), " "))
+				continue
+			}
+			for i, text := range strings.Split(strings.TrimPrefix(string(t), "\n"), "\n") {
+				if i > 0 {
+					layout.line(line)
+					line = nil
+				}
+				if text != "" {
+					add(text)
+				}
+			}
+		}
+	}
+	flush()
+
+	return layout.document(), nil
+}
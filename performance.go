@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// startOfDay returns midnight local time of the provided date.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// holdings returns the shares held of each ticker and the cash balance
+// of the account at the end of the date.
+func (a account) holdings(date time.Time) (map[string]float64, float64) {
+	var (
+		shares = make(map[string]float64)
+		cash   float64
+	)
+
+	for _, t := range a.ledger() {
+		if d, err := t.time(); err != nil || d.After(date) {
+			continue
+		}
+
+		ticker := strings.TrimSpace(strings.ToLower(t.Ticker))
+		switch t.Type {
+		case "buy":
+			shares[ticker] = shares[ticker] + t.Quantity
+		case "sell":
+			shares[ticker] = shares[ticker] - t.Quantity
+		}
+		cash = cash + a.cashFlow(t)
+	}
+
+	return shares, cash
+}
+
+// priceOn returns the closing price of the ticker on the date and the
+// currency it is in, when no closing price has been recorded the most
+// recent trade price from the ledger is used instead.
+func priceOn(ticker string, date time.Time) (float64, string) {
+	var (
+		price    float64
+		currency string
+		last     string
+	)
+
+	if p, ok := history.close(ticker, date); ok {
+		return p, tickerCurrency(ticker)
+	}
+
+	for _, a := range config.Accounts {
+		for _, t := range a.Transactions {
+			if strings.ToLower(t.Ticker) != ticker || t.Price <= 0 || t.Date > date.Format(dateFormat) || t.Date < last {
+				continue
+			}
+			price = t.Price
+			currency = a.currency()
+			if t.Currency != "" {
+				currency = t.Currency
+			}
+			last = t.Date
+		}
+	}
+
+	return price, currency
+}
+
+// matches reports if the scope includes the account.
+func (s performanceScope) matches(a account) bool {
+	return s.Account == "" || s.Account == a.Name
+}
+
+// value returns the market value of the scope in the base currency at
+// the end of the date, cash is included unless the scope is a single
+// ticker. Prices are converted from the currency they are quoted in and
+// cash from the currency of the account, both at the current exchange
+// rate as no history of rates is kept.
+func (s performanceScope) value(date time.Time) float64 {
+	var v float64
+
+	for _, a := range config.Accounts {
+		if !s.matches(a) {
+			continue
+		}
+
+		shares, cash := a.holdings(date)
+		for ticker, q := range shares {
+			if q == 0 || (s.Ticker != "" && s.Ticker != ticker) {
+				continue
+			}
+			price, currency := priceOn(ticker, date)
+			rate, _ := fxRate(currency)
+			v = v + q*price*rate
+		}
+		if s.Ticker == "" {
+			rate, _ := fxRate(a.currency())
+			v = v + cash*rate
+		}
+	}
+
+	return v
+}
+
+// flow returns the net external cash flow into the scope on the date in
+// the base currency. For accounts these are deposits and withdrawals,
+// for a single ticker these are purchases, sales and dividends paid.
+func (s performanceScope) flow(date time.Time) float64 {
+	var (
+		f float64
+		d = date.Format(dateFormat)
+	)
+
+	for _, a := range config.Accounts {
+		if !s.matches(a) {
+			continue
+		}
+
+		rate, _ := fxRate(a.currency())
+		for _, t := range a.Transactions {
+			if t.Date != d {
+				continue
+			}
+
+			if s.Ticker == "" {
+				switch t.Type {
+				case "deposit", "withdrawal":
+					f = f + a.cashFlow(t)*rate
+				}
+				continue
+			}
+
+			if strings.TrimSpace(strings.ToLower(t.Ticker)) != s.Ticker {
+				continue
+			}
+			switch t.Type {
+			case "buy", "sell", "dividend":
+				f = f - a.cashFlow(t)*rate
+			}
+		}
+	}
+
+	return f
+}
+
+// inception returns the date of the first transaction in the scope.
+func (s performanceScope) inception() time.Time {
+	var first time.Time
+
+	for _, a := range config.Accounts {
+		if !s.matches(a) {
+			continue
+		}
+		for _, t := range a.Transactions {
+			if s.Ticker != "" && strings.TrimSpace(strings.ToLower(t.Ticker)) != s.Ticker {
+				continue
+			}
+			if d, err := t.time(); err == nil && (first.IsZero() || d.Before(first)) {
+				first = d
+			}
+		}
+	}
+
+	return first
+}
+
+// timeWeightedReturn chain links the daily returns of the scope between
+// the start and end dates. Flows are assumed to take place at the close
+// of the day they occur on.
+func (s performanceScope) timeWeightedReturn(start time.Time, end time.Time) float64 {
+	var (
+		growth = 1.0
+		prev   = s.value(start)
+	)
+
+	for d := startOfDay(start).AddDate(0, 0, 1); !d.After(end); d = d.AddDate(0, 0, 1) {
+		v := s.value(d)
+		if prev > 0 {
+			growth = growth * (v - s.flow(d)) / prev
+		}
+		prev = v
+	}
+
+	return growth - 1
+}
+
+// moneyWeightedReturn returns the internal rate of return of the scope
+// between the start and end dates, annualized unless the return is over
+// the period. The opening value is treated as an investment and the
+// closing value as a withdrawal.
+func (s performanceScope) moneyWeightedReturn(start time.Time, end time.Time, annualized bool) (float64, error) {
+	var (
+		amounts []float64
+		dates   []time.Time
+		days    = 365.0
+	)
+
+	if !annualized {
+		days = end.Sub(start).Hours() / 24
+	}
+
+	amounts = append(amounts, -s.value(start))
+	dates = append(dates, start)
+
+	for d := startOfDay(start).AddDate(0, 0, 1); !d.After(end); d = d.AddDate(0, 0, 1) {
+		if f := s.flow(d); f != 0 {
+			amounts = append(amounts, -f)
+			dates = append(dates, d)
+		}
+	}
+
+	amounts = append(amounts, s.value(end))
+	dates = append(dates, end)
+
+	return xirr(amounts, dates, days)
+}
+
+// xirr solves for the rate over a period of the days at which the net
+// present value of the cash flows is zero, the annualized rate when the
+// period is 365 days.
+func xirr(amounts []float64, dates []time.Time, days float64) (float64, error) {
+	npv := func(rate float64) float64 {
+		var v float64
+		for i, a := range amounts {
+			periods := dates[i].Sub(dates[0]).Hours() / 24 / days
+			v = v + a/math.Pow(1+rate, periods)
+		}
+		return v
+	}
+
+	low, high := -0.9999, 100.0
+	if npv(low)*npv(high) > 0 {
+		return 0, errors.New("no rate of return solves the cash flows")
+	}
+
+	for i := 0; i < 200; i++ {
+		mid := (low + high) / 2
+		if npv(low)*npv(mid) <= 0 {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+
+	return (low + high) / 2, nil
+}
+
+// performancePeriods returns the periods returns are reported over
+// ending on the provided date, the money-weighted returns of the day and
+// week are not annualized.
+func performancePeriods(end time.Time, inception time.Time) []performancePeriod {
+	end = startOfDay(end)
+	quarter := time.Month((int(end.Month())-1)/3*3 + 1)
+
+	return []performancePeriod{
+		{Name: "Day", Start: end.AddDate(0, 0, -1)},
+		{Name: "Week", Start: end.AddDate(0, 0, -7)},
+		{Name: "MTD", Start: time.Date(end.Year(), end.Month(), 0, 0, 0, 0, 0, time.Local), Annualized: true},
+		{Name: "QTD", Start: time.Date(end.Year(), quarter, 0, 0, 0, 0, 0, time.Local), Annualized: true},
+		{Name: "YTD", Start: time.Date(end.Year(), time.January, 0, 0, 0, 0, 0, time.Local), Annualized: true},
+		{Name: "1Y", Start: end.AddDate(-1, 0, 0), Annualized: true},
+		{Name: "Inception", Start: startOfDay(inception).AddDate(0, 0, -1), Annualized: true},
+	}
+}
+
+// performanceScopes returns the overall portfolio, each account and each
+// ticker held in the ledger.
+func performanceScopes() []performanceScope {
+	var (
+		scopes  = []performanceScope{{Name: "Overall"}}
+		tickers []string
+		seen    = make(map[string]bool)
+	)
+
+	for _, a := range config.Accounts {
+		scopes = append(scopes, performanceScope{Name: "Account " + a.Name, Account: a.Name})
+		for _, t := range a.Transactions {
+			ticker := strings.TrimSpace(strings.ToLower(t.Ticker))
+			if ticker != "" && !seen[ticker] {
+				seen[ticker] = true
+				tickers = append(tickers, ticker)
+			}
+		}
+	}
+
+	for _, t := range tickers {
+		scopes = append(scopes, performanceScope{Name: strings.ToUpper(t), Ticker: t})
+	}
+
+	return scopes
+}
+
+// displayPerformance returns a string for display in the terminal window
+// of the time-weighted and money-weighted returns of the portfolio.
+func displayPerformance(end time.Time) string {
+	var output bytes.Buffer
+
+	end = startOfDay(end)
+
+	for _, s := range performanceScopes() {
+		periods := performancePeriods(end, s.inception())
+
+		output.WriteString(s.Name + "\n")
+		output.WriteString(alignLeft("Period", 8))
+		for _, p := range periods {
+			output.WriteString(alignRight(p.Name, 11))
+		}
+		output.WriteString("\n" + alignLeft("TWR", 8))
+		for _, p := range periods {
+			output.WriteString(alignRight(strconv.FormatFloat(s.timeWeightedReturn(p.Start, end)*100, 'f', 2, 64)+"%", 11))
+		}
+		output.WriteString("\n" + alignLeft("XIRR", 8))
+		for _, p := range periods {
+			if r, err := s.moneyWeightedReturn(p.Start, end, p.Annualized); err != nil {
+				output.WriteString(alignRight("-", 11))
+			} else {
+				output.WriteString(alignRight(strconv.FormatFloat(r*100, 'f', 2, 64)+"%", 11))
+			}
+		}
+		output.WriteString("\n\n")
+	}
+
+	return output.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// performanceDate returns midnight local time of the date.
+func performanceDate(t *testing.T, date string) time.Time {
+	d, err := time.ParseInLocation(dateFormat, date, time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// performanceAccount buys ten shares at 100 and another five at 120 four
+// days later, depositing the cash for each purchase.
+var performanceAccount = account{
+	Name: "ira",
+	Transactions: []transaction{
+		{Date: "2024-01-01", Type: "deposit", Amount: 1000},
+		{Date: "2024-01-01", Type: "buy", Ticker: "abc", Quantity: 10, Price: 100},
+		{Date: "2024-01-05", Type: "deposit", Amount: 1000},
+		{Date: "2024-01-05", Type: "buy", Ticker: "abc", Quantity: 5, Price: 120},
+	},
+}
+
+func TestXirr(t *testing.T) {
+	tests := []struct {
+		amounts []float64
+		dates   []string
+		days    float64
+		want    float64
+	}{
+		{[]float64{-1000, 1100}, []string{"2023-01-01", "2024-01-01"}, 365, 0.1},
+		{[]float64{-10000, 2750, 4250, 3250, 2750}, []string{"2008-01-01", "2008-03-01", "2008-10-30", "2009-02-15", "2009-04-01"}, 365, 0.373362535},
+		{[]float64{-1000, -1000, 2200}, []string{"2023-01-01", "2023-07-02", "2024-01-01"}, 365, 0.134627},
+		{[]float64{-1000, 1010}, []string{"2024-01-01", "2024-01-02"}, 1, 0.01},
+		{[]float64{-1000, 950}, []string{"2024-01-01", "2024-01-08"}, 7, -0.05},
+	}
+
+	for _, tc := range tests {
+		var dates []time.Time
+		for _, d := range tc.dates {
+			dates = append(dates, performanceDate(t, d))
+		}
+
+		got, err := xirr(tc.amounts, dates, tc.days)
+		if err != nil {
+			t.Errorf("xirr(%v): %v", tc.amounts, err)
+			continue
+		}
+		if math.Abs(got-tc.want) > 1e-4 {
+			t.Errorf("xirr(%v) = %f, want %f", tc.amounts, got, tc.want)
+		}
+	}
+
+	if _, err := xirr([]float64{1000, 1000}, []time.Time{performanceDate(t, "2024-01-01"), performanceDate(t, "2025-01-01")}, 365); err == nil {
+		t.Error("xirr of only positive cash flows succeeded, want an error")
+	}
+}
+
+func TestTimeWeightedReturn(t *testing.T) {
+	config = configuration{Accounts: []account{performanceAccount}}
+	defer func() { config = configuration{} }()
+
+	start, end := performanceDate(t, "2024-01-01"), performanceDate(t, "2024-01-05")
+
+	for _, s := range []performanceScope{{Name: "Overall"}, {Name: "ira", Account: "ira"}, {Name: "ABC", Ticker: "abc"}} {
+		if got := s.timeWeightedReturn(start, end); math.Abs(got-0.2) > 1e-9 {
+			t.Errorf("%s time-weighted return = %f, want 0.2", s.Name, got)
+		}
+	}
+
+	if got := (performanceScope{Account: "other"}).timeWeightedReturn(start, end); got != 0 {
+		t.Errorf("time-weighted return of an unknown account = %f, want 0", got)
+	}
+}
+
+func TestMoneyWeightedReturn(t *testing.T) {
+	config = configuration{Accounts: []account{performanceAccount}}
+	defer func() { config = configuration{} }()
+
+	var (
+		s          = performanceScope{Name: "Overall"}
+		start, end = performanceDate(t, "2024-01-01"), performanceDate(t, "2024-01-05")
+	)
+
+	got, err := s.moneyWeightedReturn(start, end, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got-0.2) > 1e-4 {
+		t.Errorf("money-weighted return over the period = %f, want 0.2", got)
+	}
+
+	// 20% in four days is beyond the range annualized returns are solved in
+	if _, err = s.moneyWeightedReturn(start, end, true); err == nil {
+		t.Error("annualized money-weighted return succeeded, want an error")
+	}
+}
+
+func TestPerformancePeriods(t *testing.T) {
+	want := []struct {
+		name       string
+		start      string
+		annualized bool
+	}{
+		{"Day", "2024-03-14", false},
+		{"Week", "2024-03-08", false},
+		{"MTD", "2024-02-29", true},
+		{"QTD", "2023-12-31", true},
+		{"YTD", "2023-12-31", true},
+		{"1Y", "2023-03-15", true},
+		{"Inception", "2022-06-30", true},
+	}
+
+	periods := performancePeriods(performanceDate(t, "2024-03-15"), performanceDate(t, "2022-07-01"))
+	if len(periods) != len(want) {
+		t.Fatalf("got %d periods, want %d", len(periods), len(want))
+	}
+	for i, p := range periods {
+		if p.Name != want[i].name || p.Start.Format(dateFormat) != want[i].start || p.Annualized != want[i].annualized {
+			t.Errorf("period %d = %s %s %v, want %s %s %v", i, p.Name, p.Start.Format(dateFormat), p.Annualized, want[i].name, want[i].start, want[i].annualized)
+		}
+	}
+}
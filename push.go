@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"encoding/json"
+	"net/url"
+)
+
+// pushPriority returns the ntfy (1 to 5) and Gotify (0 to 10) priorities
+// of an alert severity.
+func pushPriority(severity string) (int, int) {
+	switch severity {
+	case "low":
+		return 2, 2
+	case "high":
+		return 4, 8
+	case "urgent":
+		return 5, 10
+	}
+	return 3, 5
+}
+
+// pushMessages returns the push messages of a notification, alerts are
+// pushed individually so each carries its own priority and link.
+func pushMessages(n notification) []pushMessage {
+	var messages []pushMessage
+
+	if n.Kind != "alert" {
+		m := pushMessage{Title: n.Subject, Message: n.text(), Severity: "normal"}
+		if n.TotalGainLoss > 0 {
+			m.Move = "up"
+		} else if n.TotalGainLoss < 0 {
+			m.Move = "down"
+		}
+		return append(messages, m)
+	}
+
+	for _, e := range n.Alerts {
+		move := ""
+		if e.Change > 0 {
+			move = "up"
+		} else if e.Change < 0 {
+			move = "down"
+		}
+		messages = append(messages, pushMessage{
+			Title:    "Stock Alert: " + e.Rule,
+			Message:  e.Message,
+			Severity: e.Severity,
+			Move:     move,
+			Ticker:   e.Ticker,
+		})
+	}
+
+	return messages
+}
+
+// pushLink returns the link to the ticker on the stockwatch web server,
+// or to the web server when there is no ticker.
+func pushLink(c notifierConfig, ticker string) string {
+	if c.WebURL == "" {
+		return ""
+	}
+
+	link := strings.TrimRight(c.WebURL, "/") + "/"
+	if ticker != "" {
+		link = link + "#" + url.PathEscape(ticker)
+	}
+
+	return link
+}
+
+// send publishes each message of the notification to the topic with its
+// title, priority, tags and click-through link.
+func (p *ntfyNotifier) send(n notification) error {
+	for _, m := range pushMessages(n) {
+		var (
+			headers  httpHeader
+			priority int
+			tags     = "chart"
+		)
+
+		priority, _ = pushPriority(m.Severity)
+		switch m.Move {
+		case "up":
+			tags = "chart_with_upwards_trend"
+		case "down":
+			tags = "chart_with_downwards_trend"
+		}
+		if m.Ticker != "" {
+			tags = tags + "," + m.Ticker
+		}
+
+		for _, h := range [][2]string{
+			{"Title", m.Title},
+			{"Priority", strconv.Itoa(priority)},
+			{"Tags", tags},
+			{"Click", pushLink(p.config, m.Ticker)},
+		} {
+			if h[1] != "" {
+				headers = append(headers, struct {
+					Name  string
+					Value string
+				}{Name: h[0], Value: h[1]})
+			}
+		}
+		if p.config.Token != "" {
+			headers = append(headers, struct {
+				Name  string
+				Value string
+			}{Name: "Authorization", Value: "Bearer " + p.config.Token})
+		}
+
+		if err := sendWithRetry(p.config, "POST", p.config.URL, headers, "text/plain", []byte(m.Message)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send sends each message of the notification to the server with its
+// title, priority and click-through link, the direction of the move is
+// shown in the title as Gotify does not support tags.
+func (g *gotifyNotifier) send(n notification) error {
+	for _, m := range pushMessages(n) {
+		var (
+			title    = m.Title
+			extras   = make(map[string]interface{})
+			priority int
+		)
+
+		_, priority = pushPriority(m.Severity)
+		switch m.Move {
+		case "up":
+			title = "▲ " + title
+		case "down":
+			title = "▼ " + title
+		}
+		if link := pushLink(g.config, m.Ticker); link != "" {
+			extras["client::notification"] = map[string]interface{}{"click": map[string]string{"url": link}}
+		}
+
+		payload, err := json.Marshal(map[string]interface{}{
+			"title":    title,
+			"message":  m.Message,
+			"priority": priority,
+			"extras":   extras,
+		})
+		if err != nil {
+			return err
+		}
+
+		endpoint := strings.TrimRight(g.config.URL, "/") + "/message?token=" + url.QueryEscape(g.config.Token)
+		if err = sendWithRetry(g.config, "POST", endpoint, nil, "application/json", payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
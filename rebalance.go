@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// validate verifies the tickers are well formed and the class and ticker
+// weights each total 100 percent.
+func (a allocation) validate() error {
+	var (
+		total float64
+		re    = regexp.MustCompile(`^[a-z0-9]+$`)
+	)
+
+	if len(a.Classes) == 0 {
+		return nil
+	}
+
+	for _, c := range a.Classes {
+		var tickers float64
+
+		total = total + c.Weight
+		for t, w := range c.Tickers {
+			if !re.MatchString(strings.TrimSpace(strings.ToLower(t))) {
+				return errors.New("asset class " + c.Name + ": ticker format error \"" + t + "\"")
+			}
+			tickers = tickers + w
+		}
+		if len(c.Tickers) > 0 && math.Abs(tickers-100) > 0.01 {
+			return errors.New("ticker weights of asset class " + c.Name + " do not total 100")
+		}
+	}
+
+	if math.Abs(total-100) > 0.01 {
+		return errors.New("asset class weights do not total 100")
+	}
+
+	return nil
+}
+
+// basePrice returns the price of the ticker in the base currency.
+func basePrice(stock iex, ticker string) (float64, bool) {
+	for _, k := range stock {
+		if strings.TrimSpace(strings.ToLower(k.Company.Symbol)) == ticker {
+			rate, ok := fxRate(quoteCurrency(k))
+			return k.Price * rate, ok
+		}
+	}
+	return 0, false
+}
+
+// rebalanceOrders returns the drift of each holding from its target
+// allocation. When a holding or its asset class has drifted outside of
+// the tolerance band the shares required to return it to the target are
+// included, when only cash may be used the available cash is divided
+// between the underweight holdings instead.
+func rebalanceOrders(stock iex) []rebalanceOrder {
+	var (
+		orders  []rebalanceOrder
+		values  = make(map[string]float64)
+		total   float64
+		cash    = cashBalance() + config.Allocation.NewCash
+		cashTgt float64
+	)
+
+	// current value of each ticker
+	for _, k := range stock {
+		for _, i := range positions {
+			if strings.TrimSpace(strings.ToLower(k.Company.Symbol)) == strings.TrimSpace(strings.ToLower(i.Ticker)) {
+				v, _, _, _, _ := lotGainLoss(i, k)
+				values[strings.TrimSpace(strings.ToLower(i.Ticker))] += v
+				total = total + v
+			}
+		}
+	}
+	total = total + cash
+
+	if total <= 0 {
+		return orders
+	}
+
+	// the weight of the asset classes held as cash
+	for _, c := range config.Allocation.Classes {
+		if len(c.Tickers) == 0 {
+			cashTgt = cashTgt + c.Weight/100
+		}
+	}
+
+	for _, c := range config.Allocation.Classes {
+		var (
+			tickers []string
+			weights = make(map[string]float64)
+			current float64
+		)
+
+		// asset classes without tickers are held as cash, which is divided
+		// between them in proportion to their targets
+		if len(c.Tickers) == 0 {
+			o := rebalanceOrder{
+				Class:  c.Name,
+				Target: c.Weight / 100,
+			}
+			if cashTgt > 0 {
+				o.Current = cash / total * o.Target / cashTgt
+			}
+			o.Drift = o.Current - o.Target
+			orders = append(orders, o)
+			continue
+		}
+
+		for t, w := range c.Tickers {
+			t = strings.TrimSpace(strings.ToLower(t))
+			tickers = append(tickers, t)
+			weights[t] = w
+			current = current + values[t]/total
+		}
+		sort.Strings(tickers)
+		classDrift := current - c.Weight/100
+
+		for _, t := range tickers {
+			o := rebalanceOrder{
+				Class:   c.Name,
+				Ticker:  t,
+				Target:  c.Weight / 100 * weights[t] / 100,
+				Current: values[t] / total,
+			}
+			o.Drift = o.Current - o.Target
+
+			price, ok := basePrice(stock, t)
+			outside := math.Abs(o.Drift)*100 > config.Allocation.Tolerance || math.Abs(classDrift)*100 > config.Allocation.Tolerance
+			if ok && price > 0 && outside && !config.Allocation.CashOnly {
+				o.Shares = math.Trunc((o.Target*total - values[t]) / price)
+			}
+
+			orders = append(orders, o)
+		}
+	}
+
+	// divide the available cash between underweight holdings in
+	// proportion to their shortfall
+	if config.Allocation.CashOnly {
+		var shortfall float64
+
+		available := cash - cashTgt*total
+		for _, o := range orders {
+			if o.Ticker != "" && o.Drift < 0 {
+				shortfall = shortfall - o.Drift*total
+			}
+		}
+
+		for i, o := range orders {
+			if available <= 0 || shortfall <= 0 || o.Ticker == "" || o.Drift >= 0 {
+				continue
+			}
+			price, ok := basePrice(stock, o.Ticker)
+			if !ok || price <= 0 {
+				continue
+			}
+			spend := math.Min(-o.Drift*total, available*(-o.Drift*total)/shortfall)
+			orders[i].Shares = math.Floor(spend / price)
+		}
+	}
+
+	return orders
+}
+
+// orderText returns a description of the rebalance order.
+func (o rebalanceOrder) orderText() string {
+	if o.Shares > 0 {
+		return "BUY " + strconv.FormatFloat(o.Shares, 'f', 0, 64)
+	} else if o.Shares < 0 {
+		return "SELL " + strconv.FormatFloat(-o.Shares, 'f', 0, 64)
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// rebalanceStock returns quotes of the tickers at the prices.
+func rebalanceStock(prices map[string]float64) iex {
+	stock := make(iex)
+	for t, p := range prices {
+		k := iexData{Price: p}
+		k.Company.Symbol = t
+		stock[t] = k
+	}
+	return stock
+}
+
+func TestRebalanceOrders(t *testing.T) {
+	defer func() {
+		config = configuration{}
+		positions = nil
+	}()
+
+	tests := []struct {
+		name      string
+		allocated allocation
+		held      investments
+		prices    map[string]float64
+		want      map[string]float64 // shares by ticker, cash classes by name
+	}{
+		{
+			"outside the tolerance",
+			allocation{Tolerance: 5, Classes: []allocationClass{
+				{Name: "stocks", Weight: 60, Tickers: map[string]float64{"aaa": 100}},
+				{Name: "bonds", Weight: 40, Tickers: map[string]float64{"bbb": 100}},
+			}},
+			investments{{Ticker: "aaa", Quantity: 80, Price: 10}, {Ticker: "bbb", Quantity: 20, Price: 10}},
+			map[string]float64{"aaa": 10, "bbb": 10},
+			map[string]float64{"aaa": -20, "bbb": 20},
+		},
+		{
+			"within the tolerance",
+			allocation{Tolerance: 5, Classes: []allocationClass{
+				{Name: "stocks", Weight: 60, Tickers: map[string]float64{"aaa": 100}},
+				{Name: "bonds", Weight: 40, Tickers: map[string]float64{"bbb": 100}},
+			}},
+			investments{{Ticker: "aaa", Quantity: 62, Price: 10}, {Ticker: "bbb", Quantity: 38, Price: 10}},
+			map[string]float64{"aaa": 10, "bbb": 10},
+			map[string]float64{"aaa": 0, "bbb": 0},
+		},
+		{
+			"partial shares are truncated",
+			allocation{Classes: []allocationClass{
+				{Name: "stocks", Weight: 50, Tickers: map[string]float64{"aaa": 100}},
+				{Name: "bonds", Weight: 50, Tickers: map[string]float64{"bbb": 100}},
+			}},
+			investments{{Ticker: "aaa", Quantity: 70, Price: 10}, {Ticker: "bbb", Quantity: 10, Price: 30}},
+			map[string]float64{"aaa": 10, "bbb": 30},
+			map[string]float64{"aaa": -20, "bbb": 6},
+		},
+		{
+			"new cash held as a class",
+			allocation{NewCash: 100, Classes: []allocationClass{
+				{Name: "stocks", Weight: 90, Tickers: map[string]float64{"aaa": 100}},
+				{Name: "cash", Weight: 10},
+			}},
+			investments{{Ticker: "aaa", Quantity: 100, Price: 10}},
+			map[string]float64{"aaa": 10},
+			map[string]float64{"aaa": -1, "cash": 0},
+		},
+		{
+			"cash only",
+			allocation{CashOnly: true, NewCash: 200, Classes: []allocationClass{
+				{Name: "stocks", Weight: 50, Tickers: map[string]float64{"aaa": 100}},
+				{Name: "bonds", Weight: 50, Tickers: map[string]float64{"bbb": 100}},
+			}},
+			investments{{Ticker: "aaa", Quantity: 60, Price: 10}, {Ticker: "bbb", Quantity: 20, Price: 10}},
+			map[string]float64{"aaa": 10, "bbb": 10},
+			map[string]float64{"aaa": 0, "bbb": 20},
+		},
+		{
+			"cash only divided by shortfall",
+			allocation{CashOnly: true, NewCash: 100, Classes: []allocationClass{
+				{Name: "stocks", Weight: 50, Tickers: map[string]float64{"aaa": 50, "bbb": 50}},
+				{Name: "bonds", Weight: 50, Tickers: map[string]float64{"ccc": 100}},
+			}},
+			investments{{Ticker: "aaa", Quantity: 20, Price: 10}, {Ticker: "bbb", Quantity: 10, Price: 10}, {Ticker: "ccc", Quantity: 60, Price: 10}},
+			map[string]float64{"aaa": 10, "bbb": 10, "ccc": 10},
+			map[string]float64{"aaa": 2, "bbb": 7, "ccc": 0},
+		},
+	}
+
+	for _, tc := range tests {
+		config = configuration{Allocation: tc.allocated}
+		positions = tc.held
+
+		orders := rebalanceOrders(rebalanceStock(tc.prices))
+		if len(orders) != len(tc.want) {
+			t.Errorf("%s: got %d orders, want %d", tc.name, len(orders), len(tc.want))
+			continue
+		}
+
+		var target float64
+		for _, o := range orders {
+			target = target + o.Target
+			name := o.Ticker
+			if name == "" {
+				name = o.Class
+			}
+			if o.Shares != tc.want[name] {
+				t.Errorf("%s: %s shares = %v, want %v", tc.name, name, o.Shares, tc.want[name])
+			}
+			if math.Abs(o.Drift-(o.Current-o.Target)) > 1e-9 {
+				t.Errorf("%s: %s drift = %f, want %f", tc.name, name, o.Drift, o.Current-o.Target)
+			}
+		}
+		if math.Abs(target-1) > 1e-9 {
+			t.Errorf("%s: targets total %f, want 1", tc.name, target)
+		}
+	}
+}
+
+func TestOrderText(t *testing.T) {
+	for shares, want := range map[float64]string{3: "BUY 3", -12: "SELL 12", 0: ""} {
+		if got := (rebalanceOrder{Shares: shares}).orderText(); got != want {
+			t.Errorf("orderText of %v shares = %q, want %q", shares, got, want)
+		}
+	}
+}
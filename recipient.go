@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"net/mail"
+
+	"github.com/TheSp1der/goerror"
+)
+
+// splitAddresses returns the addresses of a comma separated list, commas
+// within quoted display names do not separate addresses.
+func splitAddresses(list string) []string {
+	var addresses []string
+
+	if strings.TrimSpace(list) == "" {
+		return addresses
+	}
+
+	if parsed, err := mail.ParseAddressList(list); err == nil {
+		for _, a := range parsed {
+			addresses = append(addresses, a.String())
+		}
+		return addresses
+	}
+
+	for _, a := range strings.Split(list, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addresses = append(addresses, a)
+		}
+	}
+
+	return addresses
+}
+
+// mailEnabled returns true when the mail server, sender and at least one
+// recipient are configured.
+func mailEnabled() bool {
+	return cmdLnEmailHost != "" && cmdLnEmailFrom != "" && (len(cmdLnEmailTo) > 0 || len(config.Recipients) > 0)
+}
+
+// validateRecipients verifies the addresses of every recipient, that the
+// accounts and tickers they subscribe to exist and the attachments and
+// reports they request are known.
+func (c configuration) validateRecipients() error {
+	var (
+		names       = make(map[string]bool)
+		reportNames = make(map[string]bool)
+		re          = regexp.MustCompile(`^[a-z0-9]+$`)
+	)
+
+	for _, a := range c.Accounts {
+		names[a.Name] = true
+	}
+	for _, r := range c.Reports {
+		reportNames[r.Name] = true
+	}
+	if len(c.Reports) == 0 {
+		reportNames[defaultReport.Name] = true
+	}
+
+	for _, r := range c.Recipients {
+		if r.Address == "" {
+			return errors.New("recipient address is required")
+		}
+		for _, a := range append(append([]string{r.Address}, r.Cc...), r.Bcc...) {
+			if _, err := mail.ParseAddress(a); err != nil {
+				return errors.New("recipient " + r.Address + ": " + err.Error())
+			}
+		}
+		for _, a := range r.Accounts {
+			if !names[a] {
+				return errors.New("recipient " + r.Address + ": unknown account \"" + a + "\"")
+			}
+		}
+		for _, t := range r.Tickers {
+			if !re.MatchString(strings.TrimSpace(strings.ToLower(t))) {
+				return errors.New("recipient " + r.Address + ": ticker format error \"" + t + "\"")
+			}
+		}
+		if err := validAttachments(r.Attachments); err != nil {
+			return errors.New("recipient " + r.Address + ": " + err.Error())
+		}
+		for _, n := range r.Reports {
+			if !reportNames[n] {
+				return errors.New("recipient " + r.Address + ": unknown report \"" + n + "\"")
+			}
+		}
+	}
+
+	return nil
+}
+
+// full returns true when the recipient does not limit the report to
+// accounts or tickers.
+func (r recipient) full() bool {
+	return len(r.Accounts) == 0 && len(r.Tickers) == 0
+}
+
+// subscribed returns true when the recipient subscribes to the account.
+func (r recipient) subscribed(account string) bool {
+	if r.full() {
+		return true
+	}
+	for _, a := range r.Accounts {
+		if a == account {
+			return true
+		}
+	}
+	return false
+}
+
+// positions returns the lots held in the accounts of the recipient.
+func (r recipient) positions() investments {
+	var p investments
+
+	if r.full() {
+		return positions
+	}
+
+	for _, i := range positions {
+		if r.subscribed(i.Account) {
+			p = append(p, i)
+		}
+	}
+
+	return p
+}
+
+// accounts returns the configured accounts the recipient subscribes to.
+func (r recipient) accounts() accounts {
+	var a accounts
+
+	for _, k := range config.Accounts {
+		if r.subscribed(k.Name) {
+			a = append(a, k)
+		}
+	}
+
+	return a
+}
+
+// wants returns true when the recipient follows the ticker, either on
+// their watchlist or held in one of their accounts.
+func (r recipient) wants(ticker string) bool {
+	ticker = strings.TrimSpace(strings.ToLower(ticker))
+
+	if r.full() {
+		return true
+	}
+	for _, t := range r.Tickers {
+		if strings.ToLower(t) == ticker {
+			return true
+		}
+	}
+	for _, i := range r.positions() {
+		if strings.ToLower(i.Ticker) == ticker {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stocks returns the stock data of the tickers the recipient follows.
+func (r recipient) stocks(stock iex) iex {
+	if r.full() {
+		return stock
+	}
+
+	s := make(iex)
+	for k, v := range stock {
+		if r.wants(v.Company.Symbol) || r.wants(k) {
+			s[k] = v
+		}
+	}
+
+	return s
+}
+
+// cash returns the cash held in the accounts of the recipient in the
+// base currency.
+func (r recipient) cash() float64 {
+	var c float64
+
+	if r.full() {
+		return cashBalance()
+	}
+
+	for _, a := range r.accounts() {
+		if rate, ok := fxRate(a.currency()); ok {
+			c = c + a.cash()*rate
+		}
+	}
+
+	return c
+}
+
+// contributions returns the net amount deposited in the accounts of the
+// recipient in the base currency.
+func (r recipient) contributions() float64 {
+	var c float64
+
+	if r.full() {
+		return netContributions()
+	}
+
+	for _, a := range r.accounts() {
+		if rate, ok := fxRate(a.currency()); ok {
+			c = c + a.contributions()*rate
+		}
+	}
+
+	return c
+}
+
+// mailHost returns the address of the mail server.
+func mailHost() string {
+	return cmdLnEmailHost + ":" + strconv.Itoa(cmdLnEmailPort)
+}
+
+// receives returns true when the recipient receives the report,
+// recipients without reports receive every report.
+func (r recipient) receives(report string) bool {
+	if len(r.Reports) == 0 {
+		return true
+	}
+	for _, n := range r.Reports {
+		if n == report {
+			return true
+		}
+	}
+	return false
+}
+
+// mailReport e-mails the report in full to the recipients on the command
+// line, and to each configured recipient receiving the report limited to
+// the accounts and tickers they subscribe to.
+func mailReport(stock iex, report reportSchedule) {
+	var (
+		send = func(m mailMessage, r recipient) error {
+			m.From = cmdLnEmailFrom
+			m.Subject = report.subject()
+			m.Text = displayText(stock, r)
+			m.HTML, m.Inline = displayHTML(stock, r)
+
+			// the returns cover the whole portfolio
+			if text, body := report.performance(); text != "" && r.full() {
+				m.Text = m.Text + "\n" + text
+				m.HTML = strings.Replace(m.HTML, "</body>", body+"\n\t</body>", 1)
+			}
+
+			attachments, err := reportAttachments(stock, r, m.HTML, m.Inline)
+			if err != nil {
+				return err
+			}
+			m.Attachments = attachments
+
+			return basicMailSend(mailHost(), m)
+		}
+	)
+
+	if len(cmdLnEmailTo) > 0 {
+		if err := send(mailMessage{To: cmdLnEmailTo, Cc: cmdLnEmailCc, Bcc: cmdLnEmailBcc}, recipient{Attachments: cmdLnEmailAttach}); err != nil {
+			goerror.Warning(err)
+		}
+	}
+
+	for _, r := range config.Recipients {
+		if !r.receives(report.Name) {
+			continue
+		}
+		if err := send(mailMessage{To: []string{r.Address}, Cc: r.Cc, Bcc: r.Bcc}, r); err != nil {
+			goerror.Warning(errors.New("recipient " + r.Address + ": " + err.Error()))
+		}
+	}
+}
+
+// mailAlerts e-mails the alert events to the recipients on the command
+// line, and to each configured recipient following the tickers alerted.
+func mailAlerts(subject string, events []alertEvent) {
+	var (
+		send = func(m mailMessage, events []alertEvent) error {
+			m.From = cmdLnEmailFrom
+			m.Subject = subject
+			m.Text = subject + "\n\n"
+			m.HTML = "<ul>\n"
+			for _, e := range events {
+				m.Text += e.Time.Format(timeFormat) + " " + e.Rule + ": " + e.Message + "\n"
+				m.HTML += "<li>" + e.Time.Format(timeFormat) + " " + html.EscapeString(e.Rule+": "+e.Message) + "</li>\n"
+			}
+			m.HTML += "</ul>"
+
+			return basicMailSend(mailHost(), m)
+		}
+	)
+
+	if len(cmdLnEmailTo) > 0 {
+		if err := send(mailMessage{To: cmdLnEmailTo, Cc: cmdLnEmailCc, Bcc: cmdLnEmailBcc}, events); err != nil {
+			goerror.Warning(err)
+		}
+	}
+
+	for _, r := range config.Recipients {
+		var wanted []alertEvent
+
+		for _, e := range events {
+			if e.Ticker == "" || r.wants(e.Ticker) {
+				wanted = append(wanted, e)
+			}
+		}
+		if len(wanted) == 0 {
+			continue
+		}
+
+		if err := send(mailMessage{To: []string{r.Address}, Cc: r.Cc, Bcc: r.Bcc}, wanted); err != nil {
+			goerror.Warning(errors.New("recipient " + r.Address + ": " + err.Error()))
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TheSp1der/goerror"
+)
+
+// reportGrace is how late a scheduled report may still be sent, reports
+// missed by more while stockwatch was not running are skipped.
+const reportGrace = time.Hour
+
+// defaultReport is the end of day report sent when no reports are
+// configured.
+var defaultReport = reportSchedule{Name: "daily", Schedule: "close+5m * * *", Subject: "Stock Alert"}
+
+// monthNames and weekdayNames are the names accepted in schedule fields,
+// indexed by their value.
+var (
+	monthNames   = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseCronField sets the values of a cron field, a comma separated list
+// of values, names or ranges with optional steps. It returns whether the
+// field holds the last trading day L, and whether it matches every value.
+func parseCronField(field string, set []bool, min int, names []string) (bool, bool, error) {
+	var last bool
+
+	value := func(s string) (int, error) {
+		for i, n := range names {
+			if n != "" && strings.ToLower(s) == n {
+				return i, nil
+			}
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < min || v > len(set)-1 {
+			// Sunday may also be given as 7
+			if err == nil && len(set) == 7 && v == 7 {
+				return 0, nil
+			}
+			return 0, errors.New("\"" + s + "\" is out of range")
+		}
+		return v, nil
+	}
+
+	for _, item := range strings.Split(field, ",") {
+		var (
+			from, to = min, len(set) - 1
+			step     = 1
+			err      error
+		)
+
+		if strings.ToUpper(item) == "L" {
+			last = true
+			continue
+		}
+
+		if i := strings.Index(item, "/"); i >= 0 {
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step < 1 {
+				return false, false, errors.New("step \"" + item[i+1:] + "\" is not a positive number")
+			}
+			item = item[:i]
+		}
+
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			if from, err = value(bounds[0]); err != nil {
+				return false, false, err
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = value(bounds[1]); err != nil {
+					return false, false, err
+				}
+			} else if step > 1 {
+				to = len(set) - 1
+			}
+			if to < from {
+				return false, false, errors.New("range \"" + item + "\" is reversed")
+			}
+		}
+
+		for v := from; v <= to; v = v + step {
+			set[v] = true
+		}
+	}
+
+	return last, field == "*", nil
+}
+
+// parseSchedule parses a schedule of the form "time days months weekdays"
+// where the time is open or close with an optional offset such as
+// close+15m, or a time of day in New York such as 08:00, and the other
+// fields are as in cron with L for the last trading day of the month or
+// week.
+func parseSchedule(expr string) (*reportTiming, error) {
+	var (
+		t      reportTiming
+		fields = strings.Fields(expr)
+		last   bool
+		err    error
+	)
+
+	if len(fields) != 4 {
+		return nil, errors.New("schedule \"" + expr + "\" must have a time, days, months and weekdays")
+	}
+
+	switch at := strings.ToLower(fields[0]); {
+	case strings.HasPrefix(at, "open") || strings.HasPrefix(at, "close"):
+		t.Anchor = "open"
+		if strings.HasPrefix(at, "close") {
+			t.Anchor = "close"
+		}
+		if offset := at[len(t.Anchor):]; offset != "" {
+			if t.Offset, err = time.ParseDuration(offset); err != nil {
+				return nil, errors.New("schedule \"" + expr + "\": " + err.Error())
+			}
+		}
+	default:
+		clock, err := time.Parse("15:04", at)
+		if err != nil {
+			return nil, errors.New("schedule \"" + expr + "\": time \"" + at + "\" is not open, close or HH:MM")
+		}
+		t.Offset = time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+	}
+
+	if t.LastDay, t.AnyDay, err = parseCronField(fields[1], t.Days[:], 1, nil); err != nil {
+		return nil, errors.New("schedule \"" + expr + "\" days: " + err.Error())
+	}
+	if last, _, err = parseCronField(fields[2], t.Months[:], 1, monthNames); err != nil {
+		return nil, errors.New("schedule \"" + expr + "\" months: " + err.Error())
+	}
+	if last {
+		return nil, errors.New("schedule \"" + expr + "\" months: L is only allowed in the days and weekdays")
+	}
+	if t.LastWeekday, t.AnyWeekday, err = parseCronField(fields[3], t.Weekdays[:], 0, weekdayNames); err != nil {
+		return nil, errors.New("schedule \"" + expr + "\" weekdays: " + err.Error())
+	}
+
+	return &t, nil
+}
+
+// matches returns true when the schedule runs on the date, schedules only
+// run on trading days. As in cron, when both the days and weekdays are
+// restricted either may match.
+func (t *reportTiming) matches(day time.Time) bool {
+	est, _ := time.LoadLocation("America/New_York")
+	day = day.In(est)
+
+	if !tradingDay(day) || !t.Months[day.Month()] {
+		return false
+	}
+
+	dom := t.Days[day.Day()] || (t.LastDay && lastTradingDayOf(day, true))
+	dow := t.Weekdays[day.Weekday()] || (t.LastWeekday && lastTradingDayOf(day, false))
+
+	switch {
+	case t.AnyDay:
+		return dow
+	case t.AnyWeekday:
+		return dom
+	}
+
+	return dom || dow
+}
+
+// at returns the time the schedule runs on the date.
+func (t *reportTiming) at(day time.Time) time.Time {
+	est, _ := time.LoadLocation("America/New_York")
+	open, close := marketHours(day)
+
+	switch t.Anchor {
+	case "open":
+		return open.Add(t.Offset)
+	case "close":
+		return close.Add(t.Offset)
+	}
+
+	ct := day.In(est)
+	return time.Date(ct.Year(), ct.Month(), ct.Day(), 0, 0, 0, 0, est).Add(t.Offset)
+}
+
+// validate parses the schedule of the report.
+func (r *reportSchedule) validate() error {
+	var err error
+
+	if r.Name == "" {
+		return errors.New("report name is required")
+	}
+	if r.timing, err = parseSchedule(r.Schedule); err != nil {
+		return errors.New("report " + r.Name + ": " + err.Error())
+	}
+
+	return nil
+}
+
+// validateReports verifies every report has a unique name and a valid
+// schedule.
+func (c configuration) validateReports() error {
+	var names = make(map[string]bool)
+
+	for i := range c.Reports {
+		if err := c.Reports[i].validate(); err != nil {
+			return err
+		}
+		if names[c.Reports[i].Name] {
+			return errors.New("report " + c.Reports[i].Name + " is defined more than once")
+		}
+		names[c.Reports[i].Name] = true
+	}
+
+	return nil
+}
+
+// reports returns the configured reports, or the default end of day
+// report when none are configured.
+func reports() []reportSchedule {
+	if len(config.Reports) > 0 {
+		return config.Reports
+	}
+
+	r := defaultReport
+	r.validate()
+
+	return []reportSchedule{r}
+}
+
+// subject returns the subject of the report.
+func (r reportSchedule) subject() string {
+	if r.Subject != "" {
+		return r.Subject
+	}
+	return "Stock Report (" + r.Name + ")"
+}
+
+// due returns the latest time the report was scheduled at up to now when
+// it has not run since the last run and is no more than the grace period
+// late.
+func (r reportSchedule) due(now time.Time, last time.Time) (time.Time, bool) {
+	for d := 0; d >= -1; d-- {
+		day := now.AddDate(0, 0, d)
+		if !r.timing.matches(day) {
+			continue
+		}
+
+		slot := r.timing.at(day)
+		if slot.After(now) {
+			continue
+		}
+		if now.Sub(slot) <= reportGrace && slot.After(last) {
+			return slot, true
+		}
+		return slot, false
+	}
+
+	return time.Time{}, false
+}
+
+// next returns the next time the report is scheduled after the time.
+func (r reportSchedule) next(after time.Time) (time.Time, bool) {
+	for d := 0; d <= 400; d++ {
+		day := after.AddDate(0, 0, d)
+		if r.timing.matches(day) && r.timing.at(day).After(after) {
+			return r.timing.at(day), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// performance returns the returns of the portfolio as plain text and
+// HTML when the report includes them and the portfolio has accounts.
+func (r reportSchedule) performance() (string, string) {
+	if !r.Performance || len(config.Accounts) == 0 {
+		return "", ""
+	}
+
+	p := displayPerformance(time.Now())
+
+	return p, "<pre>" + html.EscapeString(p) + "</pre>"
+}
+
+// run sends the report by e-mail and to the notifiers.
+func (r reportSchedule) run(stock iex) {
+	if mailEnabled() {
+		mailReport(stock, r)
+	}
+
+	n := summaryNotification(stock)
+	n.Subject = r.subject()
+	notify(n)
+}
+
+// runReports sends each report when it is scheduled, the time of every
+// run is recorded in the history database so a report is sent once even
+// when stockwatch is restarted.
+func runReports(sData chan iex) {
+	var runs = make(map[string]time.Time)
+
+	// without a history database the runs before starting are unknown, so
+	// reports scheduled before then are treated as sent
+	for _, r := range reports() {
+		runs[r.Name] = history.lastReport(r.Name)
+		if history.db == nil {
+			runs[r.Name] = time.Now()
+		}
+	}
+
+	for {
+		var ran bool
+
+		for _, r := range reports() {
+			slot, ok := r.due(time.Now(), runs[r.Name])
+			if !ok {
+				continue
+			}
+
+			// record the run before sending so a failure is not repeated
+			runs[r.Name] = slot
+			if err := history.putReport(r.Name, slot); err != nil {
+				goerror.Warning(err)
+			}
+
+			r.run(<-sData)
+			ran = true
+		}
+
+		// fill in any missing price history
+		if ran && cmdLnHistoryFile != "" {
+			if err := backfillHistory(); err != nil {
+				goerror.Warning(err)
+			}
+		}
+
+		time.Sleep(time.Second * 30)
+	}
+}
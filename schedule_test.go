@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// newYork returns the time of day in New York.
+func newYork(t *testing.T, value string) time.Time {
+	est, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct, err := time.ParseInLocation("2006-01-02 15:04", value, est)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ct
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []struct {
+		schedule string
+		want     string
+	}{
+		{"close * *", "must have"},
+		{"noon * * *", "is not open, close or HH:MM"},
+		{"25:00 * * *", "is not open, close or HH:MM"},
+		{"close+1x * * *", "unknown unit"},
+		{"close 0 * *", "out of range"},
+		{"close 32 * *", "out of range"},
+		{"close * 13 *", "out of range"},
+		{"close * * 8", "out of range"},
+		{"close * foo *", "out of range"},
+		{"close 10-5 * *", "reversed"},
+		{"close */0 * *", "step"},
+		{"close * L *", "L is only allowed in the days and weekdays"},
+		{"close * jan,L *", "L is only allowed in the days and weekdays"},
+	}
+
+	for _, tc := range tests {
+		_, err := parseSchedule(tc.schedule)
+		if err == nil {
+			t.Errorf("parseSchedule(%q) succeeded, want an error", tc.schedule)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parseSchedule(%q) = %q, want it to mention %q", tc.schedule, err, tc.want)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, schedule := range []string{
+		"close * * *",
+		"open-30m * * mon-fri",
+		"08:00 1,15 * *",
+		"close+15m L * L",
+		"close * jan-mar/2 *",
+		"close * * 7",
+		"CLOSE * DEC FRI",
+	} {
+		if _, err := parseSchedule(schedule); err != nil {
+			t.Errorf("parseSchedule(%q): %v", schedule, err)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		schedule string
+		after    string
+		want     string
+	}{
+		{"close+15m * * *", "2024-07-03 10:00", "2024-07-03 13:15"},
+		{"close+15m * * *", "2024-07-03 13:15", "2024-07-05 16:15"},
+		{"open-30m * * *", "2024-01-01 00:00", "2024-01-02 09:00"},
+		{"08:00 * * *", "2024-03-29 00:00", "2024-04-01 08:00"},
+		{"close 1 * *", "2025-01-01 00:00", "2025-04-01 16:00"},
+		{"close L * *", "2024-03-01 00:00", "2024-03-28 16:00"},
+		{"close L * *", "2024-11-01 00:00", "2024-11-29 13:00"},
+		{"08:00 * * L", "2025-04-14 09:00", "2025-04-17 08:00"},
+		{"open * * mon-fri/2", "2024-01-01 00:00", "2024-01-03 09:30"},
+		{"close 15 * fri", "2024-02-10 00:00", "2024-02-15 16:00"},
+		{"close 24 dec *", "2024-12-01 00:00", "2024-12-24 13:00"},
+	}
+
+	for _, tc := range tests {
+		r := reportSchedule{Name: "test", Schedule: tc.schedule}
+		if err := r.validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		next, ok := r.next(newYork(t, tc.after))
+		if !ok || !next.Equal(newYork(t, tc.want)) {
+			t.Errorf("%q after %s = %s, want %s", tc.schedule, tc.after, next, tc.want)
+		}
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	r := reportSchedule{Name: "test", Schedule: "close+5m * * *"}
+	if err := r.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now  string
+		last string
+		want bool
+	}{
+		{"2024-06-03 16:04", "2024-05-31 16:05", false},
+		{"2024-06-03 16:05", "2024-05-31 16:05", true},
+		{"2024-06-03 17:05", "2024-05-31 16:05", true},
+		{"2024-06-03 17:06", "2024-05-31 16:05", false},
+		{"2024-06-03 16:30", "2024-06-03 16:05", false},
+		{"2024-06-04 00:30", "2024-05-31 16:05", false},
+	}
+
+	for _, tc := range tests {
+		if _, due := r.due(newYork(t, tc.now), newYork(t, tc.last)); due != tc.want {
+			t.Errorf("due at %s after %s = %v, want %v", tc.now, tc.last, due, tc.want)
+		}
+	}
+}
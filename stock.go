@@ -25,6 +25,19 @@ func updateStockData(sData chan<- iex) {
 				time.Sleep(time.Duration(time.Millisecond * 500))
 				continue
 			}
+
+			// record price history
+			if err = history.record(s); err != nil {
+				goerror.Warning(err)
+			}
+			if err = history.recordValuations(s); err != nil {
+				goerror.Warning(err)
+			}
+
+			// report alerts that have become true
+			if events := alerts.evaluate(s); len(events) > 0 {
+				go deliverAlerts(events)
+			}
 		}
 
 		if time.Now().After(runTime) {
@@ -52,50 +65,24 @@ func updateStockData(sData chan<- iex) {
 }
 
 // marketStatus will determine if the market is open, if it is closed
-// it will return the time until it is open again.
+// it will return the time until it is open again. Weekends, market
+// holidays and early closes follow the trading calendar.
 func marketStatus() (bool, time.Duration) {
-	var (
-		o int
-		c int
-	)
+	now := time.Now()
 
-	// get current new york time
-	est, _ := time.LoadLocation("America/New_York")
-	ct := time.Now().In(est)
-
-	// get num of days until next open day
-	switch ct.Weekday() {
-	// Sun
-	case 0:
-		o = 1
-		c = 1
-	// Mon, Tues, Wed, Thur
-	case 1, 2, 3, 4:
-		if ct.After(time.Date(ct.Year(), ct.Month(), ct.Day(), 16, 0, 0, 0, est)) {
-			o = 1
-			c = 1
-		}
-	// Fri
-	case 5:
-		if ct.After(time.Date(ct.Year(), ct.Month(), ct.Day(), 16, 0, 0, 0, est)) {
-			o = 3
-			c = 3
-		}
-	// Sat
-	case 6:
-		o = 2
-		c = 2
-	}
-	open := time.Date(ct.Year(), ct.Month(), ct.Day()+o, 9, 30, 0, 0, est)
-	close := time.Date(ct.Year(), ct.Month(), ct.Day()+c, 16, 0, 0, 0, est)
-
-	// if the market is open return true
-	if ct.After(open) && ct.Before(close) {
+	if open, close := marketHours(now); tradingDay(now) && !now.Before(open) && now.Before(close) {
 		return true, 0
 	}
 
-	// otherwise return false with time until it is open
-	return false, open.Sub(ct)
+	// find the next trading day that has not yet opened, midday avoids
+	// the date changing across daylight saving transitions
+	est, _ := time.LoadLocation("America/New_York")
+	ct := now.In(est)
+	for d := time.Date(ct.Year(), ct.Month(), ct.Day(), 12, 0, 0, 0, est); ; d = d.AddDate(0, 0, 1) {
+		if open, _ := marketHours(d); tradingDay(d) && now.Before(open) {
+			return false, open.Sub(now)
+		}
+	}
 }
 
 // getPrices will get the current stock data.
@@ -129,6 +116,7 @@ func getPrices() (iex, error) {
 	if err = json.Unmarshal(resp, &stockData); err != nil {
 		goerror.Info(err)
 	}
+	quoteCurrencies.remember(stockData)
 
 	return stockData, nil
 }
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"encoding/csv"
+)
+
+// gain returns the reportable gain/loss, disallowed wash sale losses are
+// added back.
+func (r realizedGain) gain() float64 {
+	return r.Proceeds - r.Cost + r.WashSale
+}
+
+// longTerm reports if the shares were held for more than one year.
+func (r realizedGain) longTerm() bool {
+	return r.Sold.After(r.Acquired.AddDate(1, 0, 0))
+}
+
+// washSale returns the portion of the realized loss that is disallowed
+// because shares of the same ticker were purchased in any account within
+// 30 days before or after the sale. The disallowed loss is added to the basis of the
+// replacement shares and the holding period of the sold shares to theirs,
+// either immediately when the purchase has already taken place or once it
+// is replayed from the ledger.
+func washSale(r realizedGain, sale int, ledger []transaction, consumed map[int]bool, capacity map[int]float64, pending map[int][]washAdjustment, open investments) (float64, investments) {
+	var (
+		perShare   = (r.Cost - r.Proceeds) / r.Quantity
+		held       = heldDays(r.Acquired, r.Sold)
+		needed     = r.Quantity
+		disallowed float64
+	)
+
+	for n, t := range ledger {
+		if needed <= 1e-9 {
+			break
+		}
+		if t.Type != "buy" || consumed[n] || capacity[n] <= 1e-9 || strings.TrimSpace(strings.ToLower(t.Ticker)) != r.Ticker {
+			continue
+		}
+		if d, _ := t.time(); d.Before(r.Sold.AddDate(0, 0, -30)) || d.After(r.Sold.AddDate(0, 0, 30)) {
+			continue
+		}
+
+		shares := math.Min(capacity[n], needed)
+		if n < sale {
+			shares = math.Min(shares, openShares(open, n))
+			if shares <= 1e-9 {
+				continue
+			}
+			open = adjustLot(open, n, shares, perShare, held)
+		} else {
+			pending[n] = append(pending[n], washAdjustment{Shares: shares, PerShare: perShare, Held: held})
+		}
+
+		capacity[n] = capacity[n] - shares
+		needed = needed - shares
+		disallowed = disallowed + shares*perShare
+	}
+
+	return disallowed, open
+}
+
+// openShares returns the shares of the purchase that have not been sold.
+func openShares(open investments, lot int) float64 {
+	var q float64
+
+	for _, i := range open {
+		if i.Lot == lot {
+			q = q + i.Quantity
+		}
+	}
+
+	return q
+}
+
+// heldDays returns the number of days shares were held between the dates.
+func heldDays(acquired time.Time, sold time.Time) int {
+	a := time.Date(acquired.Year(), acquired.Month(), acquired.Day(), 0, 0, 0, 0, time.UTC)
+	s := time.Date(sold.Year(), sold.Month(), sold.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(s.Sub(a).Hours() / 24)
+}
+
+// adjustLot increases the basis of shares of the purchase by the amount
+// per share and moves their acquisition date back by the days held,
+// splitting the lot when only some of its shares are adjusted. Shares not
+// yet adjusted are chosen first.
+func adjustLot(open investments, lot int, shares float64, perShare float64, held int) investments {
+	for i := len(open) - 1; i >= 0 && shares > 1e-9; i-- {
+		if open[i].Lot != lot || open[i].Quantity <= 0 {
+			continue
+		}
+
+		if open[i].Quantity <= shares {
+			open[i].Price = open[i].Price + perShare
+			open[i].Date = open[i].Date.AddDate(0, 0, -held)
+			shares = shares - open[i].Quantity
+			continue
+		}
+
+		adjusted := open[i]
+		adjusted.Quantity = shares
+		adjusted.Price = adjusted.Price + perShare
+		adjusted.Date = adjusted.Date.AddDate(0, 0, -held)
+		open[i].Quantity = open[i].Quantity - shares
+		shares = 0
+
+		open = append(open[:i], append(investments{adjusted}, open[i:]...)...)
+	}
+
+	return open
+}
+
+// realizedGains returns the gains/losses realized across all accounts
+// during the year, or every year when the year is zero.
+func realizedGains(year int) []realizedGain {
+	var gains []realizedGain
+
+	_, realized, _ := matchAccounts(config.Accounts)
+	for _, r := range realized {
+		if year == 0 || r.Sold.Year() == year {
+			gains = append(gains, r)
+		}
+	}
+
+	sort.SliceStable(gains, func(i, j int) bool {
+		return gains[i].Sold.Before(gains[j].Sold)
+	})
+
+	return gains
+}
+
+// displayRealized returns a string for display in the terminal window of
+// the realized gains/losses for the year split by holding period.
+func displayRealized(year int) string {
+	var (
+		output bytes.Buffer
+		gains  = realizedGains(year)
+	)
+
+	for _, term := range []bool{false, true} {
+		var proceeds, cost, wash, gain float64
+
+		if term {
+			output.WriteString("Long-Term (held more than one year)\n")
+		} else {
+			output.WriteString("Short-Term (held one year or less)\n")
+		}
+		output.WriteString(alignLeft("Account", 12) + alignLeft("Ticker", 8) + alignLeft("Acquired", 11) + alignLeft("Sold", 11) +
+			alignRight("Quantity", 10) + alignRight("Proceeds", 12) + alignRight("Cost", 12) + alignRight("Wash Sale", 11) + alignRight("Gain/Loss", 12) + "\n")
+
+		for _, r := range gains {
+			if r.longTerm() != term {
+				continue
+			}
+			proceeds = proceeds + r.Proceeds
+			cost = cost + r.Cost
+			wash = wash + r.WashSale
+			gain = gain + r.gain()
+
+			output.WriteString(alignLeft(r.Account, 12) + alignLeft(strings.ToUpper(r.Ticker), 8) +
+				alignLeft(r.Acquired.Format(dateFormat), 11) + alignLeft(r.Sold.Format(dateFormat), 11) +
+				alignRight(strconv.FormatFloat(r.Quantity, 'f', -1, 64), 10) +
+				alignRight(strconv.FormatFloat(r.Proceeds, 'f', 2, 64), 12) +
+				alignRight(strconv.FormatFloat(r.Cost, 'f', 2, 64), 12) +
+				alignRight(strconv.FormatFloat(r.WashSale, 'f', 2, 64), 11) +
+				alignRight(strconv.FormatFloat(r.gain(), 'f', 2, 64), 12) + "\n")
+		}
+
+		output.WriteString(alignLeft("Total", 52) +
+			alignRight(strconv.FormatFloat(proceeds, 'f', 2, 64), 12) +
+			alignRight(strconv.FormatFloat(cost, 'f', 2, 64), 12) +
+			alignRight(strconv.FormatFloat(wash, 'f', 2, 64), 11) +
+			alignRight(strconv.FormatFloat(gain, 'f', 2, 64), 12) + "\n\n")
+	}
+
+	return output.String()
+}
+
+// writeForm8949 writes the realized gains/losses for the year as CSV in
+// the layout of IRS Form 8949, short-term sales are reported in Part I
+// and long-term sales in Part II.
+func writeForm8949(w io.Writer, year int) error {
+	out := csv.NewWriter(w)
+
+	if err := out.Write([]string{"Part", "Account", "(a) Description of property", "(b) Date acquired", "(c) Date sold or disposed of",
+		"(d) Proceeds", "(e) Cost or other basis", "(f) Code", "(g) Amount of adjustment", "(h) Gain or (loss)"}); err != nil {
+		return err
+	}
+
+	for _, term := range []bool{false, true} {
+		for _, r := range realizedGains(year) {
+			if r.longTerm() != term {
+				continue
+			}
+
+			var (
+				part = "I"
+				code string
+				adj  string
+			)
+			if term {
+				part = "II"
+			}
+			if r.WashSale > 0 {
+				code = "W"
+				adj = strconv.FormatFloat(r.WashSale, 'f', 2, 64)
+			}
+
+			if err := out.Write([]string{
+				part,
+				r.Account,
+				strconv.FormatFloat(r.Quantity, 'f', -1, 64) + " sh. " + strings.ToUpper(r.Ticker),
+				r.Acquired.Format("01/02/2006"),
+				r.Sold.Format("01/02/2006"),
+				strconv.FormatFloat(r.Proceeds, 'f', 2, 64),
+				strconv.FormatFloat(r.Cost, 'f', 2, 64),
+				code,
+				adj,
+				strconv.FormatFloat(r.gain(), 'f', 2, 64),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
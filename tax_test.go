@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"encoding/csv"
+)
+
+// taxAccount returns an account holding the transactions.
+func taxAccount(name string, transactions ...transaction) account {
+	return account{Name: name, Transactions: transactions}
+}
+
+func TestMatchAccounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		accounts []account
+		wash     []float64 // disallowed loss of each lot sold
+		open     []string  // account ticker quantity@basis acquired
+	}{
+		{
+			"replacement bought before the sale",
+			[]account{taxAccount("a",
+				transaction{Date: "2024-01-02", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 100},
+				transaction{Date: "2024-03-01", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 90},
+				transaction{Date: "2024-03-15", Type: "sell", Ticker: "aaa", Quantity: 10, Price: 80},
+			)},
+			[]float64{200},
+			[]string{"a aaa 10@110.00 2023-12-19"},
+		},
+		{
+			"replacement bought after the sale",
+			[]account{taxAccount("a",
+				transaction{Date: "2024-01-02", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 100},
+				transaction{Date: "2024-02-01", Type: "sell", Ticker: "aaa", Quantity: 10, Price: 80},
+				transaction{Date: "2024-02-20", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 85},
+			)},
+			[]float64{200},
+			[]string{"a aaa 10@105.00 2024-01-21"},
+		},
+		{
+			"partial replacement",
+			[]account{taxAccount("a",
+				transaction{Date: "2024-01-02", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 100},
+				transaction{Date: "2024-02-01", Type: "sell", Ticker: "aaa", Quantity: 10, Price: 80},
+				transaction{Date: "2024-02-10", Type: "buy", Ticker: "aaa", Quantity: 4, Price: 85},
+			)},
+			[]float64{80},
+			[]string{"a aaa 4@105.00 2024-01-11"},
+		},
+		{
+			"purchase outside the window",
+			[]account{taxAccount("a",
+				transaction{Date: "2024-01-02", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 100},
+				transaction{Date: "2024-02-01", Type: "sell", Ticker: "aaa", Quantity: 10, Price: 80},
+				transaction{Date: "2024-03-05", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 85},
+			)},
+			[]float64{0},
+			[]string{"a aaa 10@85.00 2024-03-05"},
+		},
+		{
+			"purchases sold in the same sale",
+			[]account{taxAccount("a",
+				transaction{Date: "2024-01-02", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 100},
+				transaction{Date: "2024-01-20", Type: "buy", Ticker: "aaa", Quantity: 5, Price: 90},
+				transaction{Date: "2024-02-01", Type: "sell", Ticker: "aaa", Quantity: 15, Price: 80},
+			)},
+			[]float64{0, 0},
+			nil,
+		},
+		{
+			"replacement in another account",
+			[]account{
+				taxAccount("a",
+					transaction{Date: "2024-01-02", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 100},
+					transaction{Date: "2024-02-01", Type: "sell", Ticker: "aaa", Quantity: 10, Price: 80},
+				),
+				taxAccount("b",
+					transaction{Date: "2024-01-10", Type: "buy", Ticker: "bbb", Quantity: 1, Price: 50},
+					transaction{Date: "2024-02-10", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 85},
+				),
+			},
+			[]float64{200},
+			[]string{"b bbb 1@50.00 2024-01-10", "b aaa 10@105.00 2024-01-11"},
+		},
+		{
+			"sales only match their own account",
+			[]account{
+				taxAccount("a", transaction{Date: "2024-01-02", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 100}),
+				taxAccount("b",
+					transaction{Date: "2024-01-03", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 90},
+					transaction{Date: "2024-06-03", Type: "sell", Ticker: "aaa", Quantity: 10, Price: 95},
+				),
+			},
+			[]float64{0},
+			[]string{"a aaa 10@100.00 2024-01-02"},
+		},
+	}
+
+	for _, tc := range tests {
+		open, realized, err := matchAccounts(tc.accounts)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+
+		if len(realized) != len(tc.wash) {
+			t.Errorf("%s: %d lots sold, want %d", tc.name, len(realized), len(tc.wash))
+		} else {
+			for i, r := range realized {
+				if fmt.Sprintf("%.2f", r.WashSale) != fmt.Sprintf("%.2f", tc.wash[i]) {
+					t.Errorf("%s: wash sale of lot %d = %.2f, want %.2f", tc.name, i, r.WashSale, tc.wash[i])
+				}
+			}
+		}
+
+		var got []string
+		for _, i := range open {
+			got = append(got, fmt.Sprintf("%s %s %v@%.2f %s", i.Account, i.Ticker, i.Quantity, i.Price, i.Date.Format(dateFormat)))
+		}
+		if strings.Join(got, ", ") != strings.Join(tc.open, ", ") {
+			t.Errorf("%s: open lots = %v, want %v", tc.name, got, tc.open)
+		}
+	}
+}
+
+func TestForm8949(t *testing.T) {
+	var buffer bytes.Buffer
+
+	// the replacement carries the holding period of the shares sold at a
+	// loss, making its own sale long-term
+	config = configuration{Accounts: []account{
+		taxAccount("a",
+			transaction{Date: "2023-01-03", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 100},
+			transaction{Date: "2023-12-01", Type: "sell", Ticker: "aaa", Quantity: 10, Price: 80},
+		),
+		taxAccount("b",
+			transaction{Date: "2023-12-15", Type: "buy", Ticker: "aaa", Quantity: 10, Price: 85},
+			transaction{Date: "2024-02-01", Type: "sell", Ticker: "aaa", Quantity: 10, Price: 120},
+		),
+	}}
+	defer func() { config = configuration{} }()
+
+	if err := writeForm8949(&buffer, 0); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"I", "a", "10 sh. AAA", "01/03/2023", "12/01/2023", "800.00", "1000.00", "W", "200.00", "0.00"},
+		{"II", "b", "10 sh. AAA", "01/17/2023", "02/01/2024", "1200.00", "1050.00", "", "", "150.00"},
+	}
+	if len(rows) != len(want)+1 {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want)+1)
+	}
+	for i, w := range want {
+		if strings.Join(rows[i+1], ",") != strings.Join(w, ",") {
+			t.Errorf("row %d = %v, want %v", i+1, rows[i+1], w)
+		}
+	}
+
+	if gains := realizedGains(2024); len(gains) != 1 || !gains[0].longTerm() {
+		t.Errorf("realized gains of 2024 = %+v, want one long-term sale", gains)
+	}
+}
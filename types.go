@@ -1,5 +1,18 @@
 package main
 
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"encoding/csv"
+	"text/template"
+
+	bolt "go.etcd.io/bbolt"
+)
+
 // httpHeader is a struct for http connections to submit multiple
 // headers with requests/gets/posts/etc.
 type httpHeader []struct {
@@ -11,9 +24,558 @@ type httpHeader []struct {
 // calculations of gains/losses.
 type investments []investment
 type investment struct {
+	Lot      int
+	Account  string
+	Date     time.Time
 	Ticker   string
 	Quantity float64
 	Price    float64
+	Currency string
+	FxRate   float64
+}
+
+// configuration is the structure of the optional configuration file.
+type configuration struct {
+	BaseCurrency  string            `json:"baseCurrency"`
+	Currencies    map[string]string `json:"currencies"`
+	Accounts      accounts          `json:"accounts"`
+	Allocation    allocation        `json:"allocation"`
+	Alerts        []alertRule       `json:"alerts"`
+	UnusualVolume float64           `json:"unusualVolume"`
+	Notifiers     []notifierConfig  `json:"notifiers"`
+	Recipients    []recipient       `json:"recipients"`
+	Reports       []reportSchedule  `json:"reports"`
+}
+
+// reportSchedule is a report sent by e-mail and to the notifiers at the
+// times of its schedule.
+type reportSchedule struct {
+	Name        string `json:"name"`
+	Schedule    string `json:"schedule"`
+	Subject     string `json:"subject"`
+	Performance bool   `json:"performance"`
+
+	timing *reportTiming
+}
+
+// reportTiming is a parsed report schedule, the time is the offset from
+// the market open or close, or from midnight in New York without an
+// anchor.
+type reportTiming struct {
+	Anchor      string
+	Offset      time.Duration
+	Days        [32]bool
+	Months      [13]bool
+	Weekdays    [7]bool
+	LastDay     bool
+	LastWeekday bool
+	AnyDay      bool
+	AnyWeekday  bool
+}
+
+// recipient receives the end of day report and alerts by e-mail, limited
+// to the accounts and watchlist tickers they subscribe to. A recipient
+// without accounts or tickers receives everything.
+type recipient struct {
+	Address     string   `json:"address"`
+	Cc          []string `json:"cc"`
+	Bcc         []string `json:"bcc"`
+	Accounts    []string `json:"accounts"`
+	Tickers     []string `json:"tickers"`
+	Attachments []string `json:"attachments"`
+	Reports     []string `json:"reports"`
+}
+
+// allocation is the target allocation of the portfolio by asset class,
+// ticker weights are a percentage of their asset class and a class
+// without tickers is held as cash.
+type allocation struct {
+	Tolerance float64           `json:"tolerance"`
+	NewCash   float64           `json:"newCash"`
+	CashOnly  bool              `json:"cashOnly"`
+	Classes   []allocationClass `json:"classes"`
+}
+type allocationClass struct {
+	Name    string             `json:"name"`
+	Weight  float64            `json:"weight"`
+	Tickers map[string]float64 `json:"tickers"`
+}
+
+// rebalanceOrder is the drift of a holding from its target allocation
+// and the shares to buy (positive) or sell (negative) to correct it.
+type rebalanceOrder struct {
+	Class   string
+	Ticker  string
+	Target  float64
+	Current float64
+	Drift   float64
+	Shares  float64
+}
+
+// accounts is a struct for tracking the cash and transaction ledger
+// of each brokerage account.
+type accounts []account
+type account struct {
+	Name         string        `json:"name"`
+	Currency     string        `json:"currency"`
+	Transactions []transaction `json:"transactions"`
+}
+type transaction struct {
+	Date     string  `json:"date"`
+	Type     string  `json:"type"`
+	Ticker   string  `json:"ticker,omitempty"`
+	Quantity float64 `json:"quantity,omitempty"`
+	Price    float64 `json:"price,omitempty"`
+	Amount   float64 `json:"amount,omitempty"`
+	Fee      float64 `json:"fee,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+	FxRate   float64 `json:"fxRate,omitempty"`
+}
+
+// realizedGain is a struct for the gain/loss of the shares of a lot
+// that have been sold. WashSale is the portion of a loss disallowed
+// because replacement shares were purchased within 30 days of the sale.
+type realizedGain struct {
+	Account  string
+	Ticker   string
+	Quantity float64
+	Acquired time.Time
+	Sold     time.Time
+	Proceeds float64
+	Cost     float64
+	WashSale float64
+}
+
+// washAdjustment is a basis adjustment to apply to the shares of a
+// purchase that replaced shares sold at a loss, along with the days the
+// sold shares were held which are added to their holding period.
+type washAdjustment struct {
+	Shares   float64
+	PerShare float64
+	Held     int
+}
+
+// exchangeRates is a struct for the rates returned by the exchange rate
+// source, each rate is the number of units of the currency one unit of
+// the base currency buys.
+type exchangeRates struct {
+	sync.Mutex
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+
+	missing map[string]bool
+}
+
+// currencyCache holds the currency the provider quoted each stock in.
+type currencyCache struct {
+	sync.Mutex
+	Symbols map[string]string
+}
+
+// currencyGainLoss is the gain/loss of the lots of a stock held in one
+// currency, in that currency, from the change in exchange rate and in the
+// base currency.
+type currencyGainLoss struct {
+	Currency string
+	Local    float64
+	FX       float64
+	Base     float64
+}
+
+// priceHistory is the embedded database of intraday ticks and daily
+// bars recorded for each symbol, along with the most recent tick of each
+// symbol.
+type priceHistory struct {
+	sync.Mutex
+	db     *bolt.DB
+	Latest map[string]priceTick
+}
+type priceTick struct {
+	Time      time.Time `json:"time"`
+	Price     float64   `json:"price"`
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
+	Volume    int64     `json:"volume"`
+	MarketCap int64     `json:"marketCap"`
+	PeRatio   float64   `json:"peRatio"`
+	Update    int64     `json:"update"`
+}
+type priceBar struct {
+	Date      string  `json:"date"`
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+	Volume    int64   `json:"volume"`
+	MarketCap int64   `json:"marketCap"`
+	PeRatio   float64 `json:"peRatio"`
+}
+
+// valuation is the end of day value of an account in the base currency.
+type valuation struct {
+	Date        string  `json:"date"`
+	MarketValue float64 `json:"marketValue"`
+	Cost        float64 `json:"cost"`
+	Cash        float64 `json:"cash"`
+	DayPL       float64 `json:"dayPL"`
+}
+
+// historyWriter writes rows of exported price history in a file format.
+type historyWriter interface {
+	write(row []interface{}) error
+	close() error
+}
+
+// csvWriter and jsonWriter are historyWriters producing CSV and JSON
+// Lines files.
+type csvWriter struct {
+	w       *csv.Writer
+	columns []exportColumn
+}
+type jsonWriter struct {
+	w       io.Writer
+	columns []exportColumn
+}
+
+// exportColumn describes a column of exported price history, the type
+// is one of string, double, int64 or timestamp.
+type exportColumn struct {
+	Name string
+	Type string
+}
+
+// parquetWriter is a historyWriter producing Apache Parquet files, rows
+// are buffered and written as a row group once enough have been
+// collected.
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []exportColumn
+	rows    [][]interface{}
+	groups  []parquetRowGroup
+}
+type parquetRowGroup struct {
+	Rows   int64
+	Chunks []parquetChunk
+}
+type parquetChunk struct {
+	Offset int64
+	Size   int64
+}
+
+// thriftWriter encodes structures using the thrift compact protocol used
+// by parquet page headers and file metadata.
+type thriftWriter struct {
+	bytes.Buffer
+	last  int
+	stack []int
+}
+
+// alertRule is a condition on a ticker or position that is reported
+// each time it becomes true. The type is one of above, below (price),
+// change (percent from the previous close), since (percent from the
+// reference price or the price when first evaluated), gain (gain/loss
+// of the positions in the base currency), expression, or one of the
+// technical indicators goldencross, deathcross, high52, low52,
+// overbought, oversold (RSI), bollinger and volume (relative volume). A
+// rule is only checked during its market session (open, closed or any)
+// outside of its quiet hours, it is not reported again within the
+// cooldown minutes and is only re-armed once the value has moved back
+// past the threshold by the hysteresis. The severity (low, normal, high
+// or urgent) sets the priority of push notifications.
+type alertRule struct {
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	Ticker     string  `json:"ticker,omitempty"`
+	Account    string  `json:"account,omitempty"`
+	Value      float64 `json:"value"`
+	Price      float64 `json:"price,omitempty"`
+	Expression string  `json:"expression,omitempty"`
+	Period     int     `json:"period,omitempty"`
+	Cooldown   int     `json:"cooldown,omitempty"`
+	Hysteresis float64 `json:"hysteresis,omitempty"`
+	QuietHours string  `json:"quietHours,omitempty"`
+	Session    string  `json:"session,omitempty"`
+	Severity   string  `json:"severity,omitempty"`
+
+	expr *exprNode
+}
+
+// exprToken is a lexical token of an alert expression, the kind is one
+// of number, string, ident, op or end.
+type exprToken struct {
+	Kind string
+	Text string
+	Pos  int
+}
+
+// exprNode is a node of a parsed alert expression. Literals hold their
+// value, fields the path of the stock data field they read and operators
+// their operands. The kind is the type the node evaluates to: number,
+// string or bool.
+type exprNode struct {
+	Op    string
+	Kind  string
+	Field string
+	Value interface{}
+	Left  *exprNode
+	Right *exprNode
+}
+
+// exprParser is a recursive descent parser of alert expressions.
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// alertEvent is an alert rule becoming true, along with the change in
+// price of the ticker today.
+type alertEvent struct {
+	Rule     string    `json:"rule"`
+	Ticker   string    `json:"ticker"`
+	Time     time.Time `json:"time"`
+	Message  string    `json:"message"`
+	Severity string    `json:"severity"`
+	Change   float64   `json:"change"`
+}
+
+// alertEngine tracks the state of every rule and the most recent events.
+type alertEngine struct {
+	sync.Mutex
+	State  map[string]alertState
+	Recent []alertEvent
+}
+
+// alertState records whether a rule is currently true so an alert is
+// only reported once per crossing, when it was last reported, and the
+// reference price of rules measuring change since creation.
+type alertState struct {
+	Active    bool      `json:"active"`
+	Fired     time.Time `json:"fired"`
+	Reference float64   `json:"reference,omitempty"`
+}
+
+// volumeCache holds the expected cumulative volume of each symbol at a
+// time of day, calculated once per day and time bucket from the ticks
+// recorded on previous days.
+type volumeCache struct {
+	sync.Mutex
+	Date     string
+	Expected map[string]float64
+}
+
+// relativeVolume is the volume of a symbol so far today compared to the
+// volume expected by this time of day.
+type relativeVolume struct {
+	Symbol   string
+	Volume   int64
+	Expected float64
+	Relative float64
+}
+
+// notifierConfig configures a channel alerts and the daily summary are
+// sent to. Events limits the notifier to alert or summary notifications,
+// the token, room and chat identify the bot and conversation of chat
+// notifiers, and the web URL of the stockwatch web server is linked to
+// from push notifications.
+type notifierConfig struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	URL        string   `json:"url"`
+	Events     []string `json:"events,omitempty"`
+	Template   string   `json:"template,omitempty"`
+	Secret     string   `json:"secret,omitempty"`
+	Token      string   `json:"token,omitempty"`
+	Room       string   `json:"room,omitempty"`
+	Chat       string   `json:"chat,omitempty"`
+	WebURL     string   `json:"webURL,omitempty"`
+	Retries    *int     `json:"retries,omitempty"`
+	DeadLetter string   `json:"deadLetter,omitempty"`
+}
+
+// notifier sends notifications over a channel.
+type notifier interface {
+	send(n notification) error
+}
+
+// webhookNotifier posts notifications to a URL as JSON rendered from a
+// template, signed with an HMAC-SHA256 of the payload when a secret is
+// configured.
+type webhookNotifier struct {
+	config   notifierConfig
+	template *template.Template
+}
+
+// slackNotifier posts notifications to a Slack compatible incoming
+// webhook as Block Kit blocks.
+type slackNotifier struct {
+	config notifierConfig
+}
+
+// matrixNotifier sends notifications as messages to a Matrix room using
+// the client-server API of the homeserver at the URL.
+type matrixNotifier struct {
+	config notifierConfig
+}
+
+// telegramNotifier sends notifications to a Telegram chat using the Bot
+// API at the URL.
+type telegramNotifier struct {
+	config notifierConfig
+}
+
+// ntfyNotifier publishes notifications to the ntfy topic at the URL.
+type ntfyNotifier struct {
+	config notifierConfig
+}
+
+// gotifyNotifier sends notifications to the Gotify server at the URL
+// using an application token.
+type gotifyNotifier struct {
+	config notifierConfig
+}
+
+// pushMessage is a message of a notification sent by a push notifier,
+// the move is up or down when the price of the ticker has changed today,
+// or for a summary when the portfolio is at a gain or loss.
+type pushMessage struct {
+	Title    string
+	Message  string
+	Severity string
+	Move     string
+	Ticker   string
+}
+
+// desktopNotifier shows notifications on the desktop through the
+// notification service on the session D-Bus.
+type desktopNotifier struct {
+	config notifierConfig
+}
+
+// notification is an alert or the daily summary sent to notifiers.
+type notification struct {
+	Kind          string         `json:"kind"`
+	Subject       string         `json:"subject"`
+	Time          time.Time      `json:"time"`
+	Alerts        []alertEvent   `json:"alerts,omitempty"`
+	Stocks        []summaryStock `json:"stocks,omitempty"`
+	BaseCurrency  string         `json:"baseCurrency"`
+	TotalGainLoss float64        `json:"totalGainLoss"`
+	Cash          float64        `json:"cash"`
+	AccountValue  float64        `json:"accountValue"`
+	Incomplete    bool           `json:"incomplete"`
+}
+type summaryStock struct {
+	Symbol        string  `json:"symbol"`
+	CompanyName   string  `json:"companyName"`
+	Price         float64 `json:"price"`
+	Change        float64 `json:"change"`
+	ChangePercent float64 `json:"changePercent"`
+	GainLoss      float64 `json:"gainLoss"`
+}
+
+// deadLetter is a notification that could not be delivered, appended to
+// the dead letter file of the notifier as a JSON line.
+type deadLetter struct {
+	Time     time.Time `json:"time"`
+	Notifier string    `json:"notifier"`
+	URL      string    `json:"url"`
+	Payload  string    `json:"payload"`
+	Error    string    `json:"error"`
+}
+
+// mailMessage is an e-mail message with plain text and HTML renditions
+// of the same content, the images shown in the HTML and attached files.
+type mailMessage struct {
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	Subject     string
+	Text        string
+	HTML        string
+	Inline      []mailPart
+	Attachments []mailPart
+}
+
+// mailPart is a file included in an e-mail message, inline parts are
+// referenced from the HTML by their content id.
+type mailPart struct {
+	Name        string
+	ContentType string
+	ContentID   string
+	Data        []byte
+}
+
+// queuedMail is a built e-mail message waiting in the mail queue until it
+// is delivered or expires, claimed is the file it is held in while a
+// delivery is attempted.
+type queuedMail struct {
+	ID         string    `json:"id"`
+	From       string    `json:"from"`
+	Recipients []string  `json:"recipients"`
+	Subject    string    `json:"subject"`
+	Message    []byte    `json:"message"`
+	Created    time.Time `json:"created"`
+	Next       time.Time `json:"next"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error"`
+	claimed    string
+}
+
+// pdfRun is text drawn in one font and colour in a PDF report, the font
+// is the name of its resource and the colour a PDF fill colour operator.
+type pdfRun struct {
+	Text  string
+	Font  string
+	Color string
+}
+
+// pdfCell is a cell of a table in a PDF report.
+type pdfCell struct {
+	Runs  []pdfRun
+	Right bool
+}
+
+// pdfLayout is a PDF report being laid out, holding the content of the
+// finished pages, the current page and the images drawn on them.
+type pdfLayout struct {
+	pages  []string
+	page   strings.Builder
+	y      float64
+	images []string
+}
+
+// mailRejection is an error returned when the e-mail server permanently
+// rejects a message, which is not worth retrying.
+type mailRejection struct {
+	err error
+}
+
+// loginAuth implements the LOGIN SMTP authentication mechanism, which
+// net/smtp does not provide.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// performanceScope identifies the holdings a return is calculated for,
+// an empty account or ticker matches all.
+type performanceScope struct {
+	Name    string
+	Account string
+	Ticker  string
+}
+
+// performancePeriod is a named period returns are reported over, the
+// money-weighted return of the period is annualized when set.
+type performancePeriod struct {
+	Name       string
+	Start      time.Time
+	Annualized bool
 }
 
 // outputStructure is the output structure available to templates
@@ -21,7 +583,29 @@ type outputStructure struct {
 	CurrentTime   string
 	MarketStatus  string
 	TotalGainLoss string
+	Cash          string
+	AccountValue  string
+	Contributions string
+	TotalReturn   string
+	BaseCurrency  string
+	Sparkline     string
+	EquityChart   string
+	DrawdownChart string
 	Stock         []stockData
+	Currency      []currencyData
+	Rebalance     []rebalanceData
+	Alerts        []alertData
+	Volume        []volumeData
+}
+type volumeData struct {
+	Symbol   string
+	Volume   string
+	Expected string
+	Relative string
+}
+type alertData struct {
+	Time    string
+	Message string
 }
 type stockData struct {
 	CompanyName  string
@@ -29,6 +613,22 @@ type stockData struct {
 	Change       string
 	GL           string
 	Symbol       string
+	Chart        string
+}
+type rebalanceData struct {
+	Class   string
+	Ticker  string
+	Target  string
+	Current string
+	Drift   string
+	Order   string
+}
+type currencyData struct {
+	Symbol   string
+	Currency string
+	Local    string
+	FX       string
+	Base     string
 }
 
 // iex is a struct for the data returned by the iex api.
@@ -39,6 +639,7 @@ type iexData struct {
 	Company iexCompany `json:"company"`
 	Stats   iexStats   `json:"stats"`
 	Ohlc    iexOhlc    `json:"ohlc"`
+	Chart   []iexChart `json:"chart"`
 }
 type iexQuote struct {
 	AvgTotalVolume        int64   `json:"avgTotalVolume"`
@@ -48,6 +649,7 @@ type iexQuote struct {
 	Close                 float64 `json:"close"`
 	CloseTime             int64   `json:"closeTime"`
 	CompanyName           string  `json:"companyName"`
+	Currency              string  `json:"currency"`
 	DelayedPrice          float64 `json:"delayedPrice"`
 	DelayedPriceTime      int64   `json:"delayedPriceTime"`
 	ExtendedChange        float64 `json:"extendedChange"`
@@ -144,6 +746,14 @@ type iexStats struct {
 	Year5ChangePercent  float64     `json:"year5ChangePercent"`
 	YtdChangePercent    float64     `json:"ytdChangePercent"`
 }
+type iexChart struct {
+	Date   string  `json:"date"`
+	Open   float64 `json:"open"`
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Close  float64 `json:"close"`
+	Volume int64   `json:"volume"`
+}
 type iexOhlc struct {
 	Close struct {
 		Price float64 `json:"price"`
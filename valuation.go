@@ -0,0 +1,261 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// accountValuations returns the current valuation of every account,
+// investments provided on the command line are valued as the default
+// account. Accounts holding a currency without an exchange rate are left
+// out rather than valued at par.
+func accountValuations(stock iex) map[string]valuation {
+	var (
+		values  = make(map[string]valuation)
+		unrated = make(map[string]bool)
+		est, _  = time.LoadLocation("America/New_York")
+		update  int64
+	)
+
+	// the valuation belongs to the trading day of the most recent quote
+	for _, k := range stock {
+		if k.Quote.LatestUpdate > update {
+			update = k.Quote.LatestUpdate
+		}
+	}
+	date := time.Now().In(est).Format(dateFormat)
+	if update > 0 {
+		date = time.Unix(0, update*int64(time.Millisecond)).In(est).Format(dateFormat)
+	}
+
+	for _, a := range config.Accounts {
+		rate, ok := fxRate(a.currency())
+		if !ok {
+			unrated[a.Name] = true
+		}
+		values[a.Name] = valuation{Date: date, Cash: a.cash() * rate}
+	}
+
+	for _, k := range stock {
+		for _, i := range positions {
+			if strings.TrimSpace(strings.ToLower(k.Company.Symbol)) != strings.TrimSpace(strings.ToLower(i.Ticker)) {
+				continue
+			}
+
+			cval, _, base, _, ok := lotGainLoss(i, k)
+			if !ok {
+				unrated[i.Account] = true
+				continue
+			}
+			quoted, _ := fxRate(quoteCurrency(k))
+			v := values[i.Account]
+			v.Date = date
+			v.MarketValue = v.MarketValue + cval
+			v.Cost = v.Cost + cval - base
+			v.DayPL = v.DayPL + i.Quantity*k.Quote.Change*quoted
+			values[i.Account] = v
+		}
+	}
+
+	for account := range unrated {
+		delete(values, account)
+	}
+
+	return values
+}
+
+// recordValuations stores the current valuation of every account as the
+// valuation for the trading day, it is replaced by each snapshot until
+// the day has ended.
+func (h *priceHistory) recordValuations(stock iex) error {
+	if h.db == nil {
+		return nil
+	}
+
+	values := accountValuations(stock)
+
+	return h.db.Update(func(tx *bolt.Tx) error {
+		for account, v := range values {
+			b, err := tx.Bucket(valuationBucket).CreateBucketIfNotExists([]byte(account))
+			if err != nil {
+				return err
+			}
+			buffer, _ := json.Marshal(v)
+			if err = b.Put([]byte(v.Date), buffer); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// equityCurve returns the dates and total value (market value plus cash)
+// of all accounts from the date onwards. An account still held without a
+// valuation on a date, such as while its exchange rate was missing, is
+// counted at its previous valuation rather than as a loss.
+func (h *priceHistory) equityCurve(from time.Time) ([]string, []float64, error) {
+	var (
+		start   = from.Format(dateFormat)
+		held    = make(map[string]bool)
+		seen    = make(map[string]bool)
+		curves  []map[string]float64
+		opening []float64
+		carry   []bool
+		dates   []string
+		values  []float64
+	)
+
+	if h.db == nil {
+		return dates, values, nil
+	}
+
+	for _, a := range config.Accounts {
+		held[a.Name] = true
+	}
+	if len(cmdLnInvestments) > 0 {
+		held["default"] = true
+	}
+
+	err := h.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(valuationBucket).ForEach(func(account []byte, _ []byte) error {
+			var (
+				totals = make(map[string]float64)
+				prior  float64
+				c      = tx.Bucket(valuationBucket).Bucket(account).Cursor()
+			)
+
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				var val valuation
+				if err := json.Unmarshal(v, &val); err != nil {
+					return err
+				}
+				if val.Date < start {
+					prior = val.MarketValue + val.Cash
+					continue
+				}
+				totals[val.Date] = val.MarketValue + val.Cash
+				if !seen[val.Date] {
+					seen[val.Date] = true
+					dates = append(dates, val.Date)
+				}
+			}
+
+			curves = append(curves, totals)
+			opening = append(opening, prior)
+			carry = append(carry, held[string(account)])
+			return nil
+		})
+	})
+
+	sort.Strings(dates)
+	values = make([]float64, len(dates))
+	for i, totals := range curves {
+		last := opening[i]
+		for n, d := range dates {
+			if v, ok := totals[d]; ok {
+				last = v
+			} else if !carry[i] {
+				continue
+			}
+			values[n] = values[n] + last
+		}
+	}
+
+	return dates, values, err
+}
+
+// drawdown returns the decline of each value from the highest preceding
+// value.
+func drawdown(values []float64) []float64 {
+	var (
+		peak float64
+		dd   []float64
+	)
+
+	for _, v := range values {
+		peak = math.Max(peak, v)
+		if peak > 0 {
+			dd = append(dd, v/peak-1)
+		} else {
+			dd = append(dd, 0)
+		}
+	}
+
+	return dd
+}
+
+// sparkline returns the values drawn with block characters, one per
+// value.
+func sparkline(values []float64) string {
+	var (
+		blocks = []rune("▁▂▃▄▅▆▇█")
+		low    = math.Inf(1)
+		high   = math.Inf(-1)
+		line   []rune
+	)
+
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+
+	for _, v := range values {
+		i := 0
+		if high > low {
+			i = int((v - low) / (high - low) * float64(len(blocks)-1))
+		}
+		line = append(line, blocks[i])
+	}
+
+	return string(line)
+}
+
+// svgChart returns an inline SVG line chart of the values, the area
+// between the line and zero is filled when fill is set.
+func svgChart(values []float64, width int, height int, stroke string, fill bool) string {
+	var (
+		low    = math.Inf(1)
+		high   = math.Inf(-1)
+		points []string
+	)
+
+	if len(values) < 2 {
+		return ""
+	}
+
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+	if fill {
+		low = math.Min(low, 0)
+		high = math.Max(high, 0)
+	}
+	if high == low {
+		high = low + 1
+	}
+
+	y := func(v float64) string {
+		return strconv.FormatFloat(float64(height)-(v-low)/(high-low)*float64(height), 'f', 1, 64)
+	}
+	for i, v := range values {
+		x := strconv.FormatFloat(float64(i)/float64(len(values)-1)*float64(width), 'f', 1, 64)
+		points = append(points, x+","+y(v))
+	}
+
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" width="` + strconv.Itoa(width) + `" height="` + strconv.Itoa(height) + `">`
+	if fill {
+		svg += `<polygon fill="` + stroke + `" fill-opacity="0.3" points="0,` + y(0) + " " + strings.Join(points, " ") + " " + strconv.Itoa(width) + "," + y(0) + `"/>`
+	}
+	svg += `<polyline fill="none" stroke="` + stroke + `" stroke-width="2" points="` + strings.Join(points, " ") + `"/>`
+	svg += `</svg>`
+
+	return svg
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// volumeDays is the number of previous days of ticks the expected volume
+// at a time of day is averaged over.
+const volumeDays = 20
+
+// sessionElapsed returns the portion of the regular trading session that
+// has elapsed at the time.
+func sessionElapsed(t time.Time) float64 {
+	open, close := marketHours(t)
+
+	elapsed := t.Sub(open).Minutes() / close.Sub(open).Minutes()
+	if elapsed > 1 {
+		return 1
+	}
+
+	return elapsed
+}
+
+// expectedVolume returns the average cumulative volume of the symbol by
+// the time of day over the previous days with recorded ticks.
+func (h *priceHistory) expectedVolume(symbol string, t time.Time) (float64, bool) {
+	var (
+		est, _ = time.LoadLocation("America/New_York")
+		ct     = t.In(est)
+		total  float64
+		days   int
+	)
+
+	for d := 1; d <= volumeDays*7/5+5 && days < volumeDays; d++ {
+		day := ct.AddDate(0, 0, -d)
+		if !tradingDay(day) {
+			continue
+		}
+
+		open := time.Date(day.Year(), day.Month(), day.Day(), 9, 30, 0, 0, est)
+		ticks, err := h.ticks(symbol, open, day)
+		if err != nil || len(ticks) == 0 {
+			continue
+		}
+
+		total = total + float64(ticks[len(ticks)-1].Volume)
+		days++
+	}
+
+	if days == 0 {
+		return 0, false
+	}
+
+	return total / float64(days), true
+}
+
+// expected returns the volume of the symbol expected by the time of day,
+// from the ticks recorded on previous days when available or otherwise
+// the average daily volume in proportion to the session elapsed. Values
+// are calculated once per day for every five minutes of the session that
+// have elapsed.
+func (c *volumeCache) expected(symbol string, average int64, t time.Time) float64 {
+	var (
+		est, _ = time.LoadLocation("America/New_York")
+		ct     = t.In(est)
+		bucket = ct.Truncate(5 * time.Minute)
+		key    = symbol + " " + bucket.Format("15:04")
+	)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.Date != ct.Format(dateFormat) {
+		c.Date = ct.Format(dateFormat)
+		c.Expected = make(map[string]float64)
+	}
+
+	if v, ok := c.Expected[key]; ok {
+		return v
+	}
+
+	v, ok := history.expectedVolume(symbol, bucket)
+	if !ok {
+		v = float64(average) * sessionElapsed(bucket)
+	}
+	c.Expected[key] = v
+
+	return v
+}
+
+// relativeVolumes returns the relative volume of every symbol while the
+// market is open.
+func relativeVolumes(stock iex) []relativeVolume {
+	var (
+		volumes     []relativeVolume
+		now         = time.Now()
+		open, close = marketHours(now)
+	)
+
+	if !tradingDay(now) || now.Before(open) || !now.Before(close) {
+		return volumes
+	}
+
+	for _, k := range stock {
+		symbol := strings.TrimSpace(strings.ToLower(k.Quote.Symbol))
+		if symbol == "" {
+			continue
+		}
+
+		expected := volumeProfile.expected(symbol, k.Quote.AvgTotalVolume, now)
+		if expected <= 0 {
+			continue
+		}
+
+		volumes = append(volumes, relativeVolume{
+			Symbol:   symbol,
+			Volume:   k.Quote.LatestVolume,
+			Expected: expected,
+			Relative: float64(k.Quote.LatestVolume) / expected,
+		})
+	}
+
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Symbol < volumes[j].Symbol
+	})
+
+	return volumes
+}
+
+// unusualVolume returns the symbols trading at least the configured
+// multiple of their expected volume, two when not configured.
+func unusualVolume(stock iex) []relativeVolume {
+	var (
+		unusual   []relativeVolume
+		threshold = config.UnusualVolume
+	)
+
+	if threshold <= 0 {
+		threshold = 2
+	}
+
+	for _, v := range relativeVolumes(stock) {
+		if v.Relative >= threshold {
+			unusual = append(unusual, v)
+		}
+	}
+
+	return unusual
+}
+
+// volumeText returns a volume formatted with a magnitude suffix.
+func volumeText(v float64) string {
+	switch {
+	case v >= 1e9:
+		return strconv.FormatFloat(v/1e9, 'f', 2, 64) + "B"
+	case v >= 1e6:
+		return strconv.FormatFloat(v/1e6, 'f', 2, 64) + "M"
+	case v >= 1e3:
+		return strconv.FormatFloat(v/1e3, 'f', 2, 64) + "K"
+	}
+	return strconv.FormatFloat(v, 'f', 0, 64)
+}
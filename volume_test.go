@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSessionElapsed(t *testing.T) {
+	est, _ := time.LoadLocation("America/New_York")
+
+	tests := []struct {
+		t    time.Time
+		want float64
+	}{
+		{time.Date(2024, 3, 14, 9, 0, 0, 0, est), -30.0 / 390},
+		{time.Date(2024, 3, 14, 12, 45, 0, 0, est), 0.5},
+		{time.Date(2024, 3, 14, 17, 0, 0, 0, est), 1},
+		{time.Date(2024, 11, 29, 11, 15, 0, 0, est), 0.5},
+	}
+
+	for _, tc := range tests {
+		if got := sessionElapsed(tc.t); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("sessionElapsed(%s) = %f, want %f", tc.t, got, tc.want)
+		}
+	}
+}
+
+func TestExpectedVolume(t *testing.T) {
+	var (
+		est, _ = time.LoadLocation("America/New_York")
+		c      volumeCache
+	)
+
+	// without history the expected volume is the average daily volume in
+	// proportion to the five minutes of the session that have elapsed
+	tests := []struct {
+		t    time.Time
+		want float64
+	}{
+		{time.Date(2024, 3, 14, 9, 33, 0, 0, est), 0},
+		{time.Date(2024, 3, 14, 10, 4, 59, 0, est), 390000 * 30 / 390},
+		{time.Date(2024, 3, 14, 10, 5, 0, 0, est), 390000 * 35 / 390},
+	}
+
+	for _, tc := range tests {
+		if got := c.expected("abc", 390000, tc.t); math.Abs(got-tc.want) > 1e-6 {
+			t.Errorf("expected volume at %s = %f, want %f", tc.t.Format("15:04:05"), got, tc.want)
+		}
+	}
+}